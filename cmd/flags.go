@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"github/DusanDjordjic/go-migrate/pkg/runner"
+)
+
+// addRunFlags adds flags shared by subcommands that execute migrations, the
+// values already in config are the defaults. The returned function finishes
+// parsing, call it after the flag set is parsed.
+func addRunFlags(fs *flag.FlagSet, config *runner.Config) func() error {
+	fs.DurationVar(&config.LockWaitTimeout, "lock-wait", config.LockWaitTimeout, "How long to wait for other processes running migrations (0 means wait forever)")
+	txMode := fs.String("tx", config.TxMode.String(), "Transaction mode: batch (one for all migrations), migration (one per migration) or none")
+	fs.DurationVar(&config.Timeout, "timeout", config.Timeout, "How long a single migration can run (0 means no limit)")
+	fs.DurationVar(&config.LockTimeout, "lock-timeout", config.LockTimeout, "How long statements wait for database locks held by other sessions (0 means database default)")
+	fs.BoolVar(&config.DryRun, "dry-run", false, "Print migrations that would be executed without executing them")
+
+	return func() error {
+		var err error
+		config.TxMode, err = runner.ParseTxMode(*txMode)
+		return err
+	}
+}
+
+// isFlagSet reports whether the flag was passed on the command line.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
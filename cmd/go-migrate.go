@@ -8,54 +8,110 @@ import (
 	"github/DusanDjordjic/go-migrate/pkg/driver"
 	"github/DusanDjordjic/go-migrate/pkg/runner"
 	"os"
+	"os/signal"
+	"os/user"
+	"strconv"
+	"syscall"
 )
 
 func main() {
-	conf, err := config.Load()
+	env := flag.String("env", "", "Environment from "+config.CONFIG_YAML_FILE+" to use, overrides "+config.ENV_ENV)
+	table := flag.String("table", "", "Name of the migrations table, overrides "+config.TABLE_ENV)
+	schema := flag.String("schema", "", "Schema of the migrations table (postgres only), overrides "+config.SCHEMA_ENV)
+	dir := flag.String("dir", "", "Folder with migration files, overrides "+config.DIR_ENV)
+	flag.Parse()
+
+	var (
+		conf config.AppConfig
+		err  error
+	)
+
+	if len(*env) > 0 {
+		conf, err = config.LoadEnvironment(*env)
+	} else {
+		conf, err = config.Load()
+	}
+
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
 
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "Usage: [subcommand] [flags]\n")
-		fmt.Fprintf(os.Stderr, "Available subcommands: init, new, up, down")
-		os.Exit(1)
+	if len(*table) > 0 {
+		conf.Table = *table
 	}
 
-	var d driver.Driver
+	if len(*schema) > 0 {
+		conf.Schema = *schema
+	}
 
-	switch conf.Driver {
-	case "postgres":
-		d = driver.NewPostgresqlDriver()
-	default:
-		fmt.Fprintf(os.Stderr, "unsupported driver %s. supported drivers %v", conf.Driver, config.AVAILABLE_DRIVERS)
+	if len(*dir) > 0 {
+		conf.MigrationsFolder = *dir
+	}
+
+	args := flag.Args()
+
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "Usage: [flags] [subcommand] [flags]\n")
+		fmt.Fprintf(os.Stderr, "Available subcommands: init, new, up, down, goto, redo, baseline, force, status, verify, repair")
 		os.Exit(1)
 	}
 
-	r, err := runner.New(
-		d,
-		runner.Config{
-			MigrationsFolder: "migrations",
-		},
-		driver.ConnectionConfig{
-			DSN:    conf.DSN,
-			Table:  "migrations",
-			Schema: "public",
-		},
-	)
+	d, err := driver.Open(conf.Driver)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to connect to the database, %s", err.Error())
+		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
 
-	ctx := context.Background()
+	runnerConfig := runner.Config{
+		MigrationsFolder: conf.MigrationsFolder,
+		LockWaitTimeout:  conf.LockWait,
+	}
 
-	switch os.Args[1] {
+	if len(conf.TxMode) > 0 {
+		runnerConfig.TxMode, err = runner.ParseTxMode(conf.TxMode)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "environment %s: %s\n", conf.Environment, err)
+			os.Exit(1)
+		}
+	}
+
+	connConfig := driver.ConnectionConfig{
+		DSN:     conf.DSN,
+		Table:   conf.Table,
+		Schema:  conf.Schema,
+		InitSQL: conf.SQLToExecOnStart,
+	}
+
+	// connect is called by subcommands after they parsed their flags into
+	// runnerConfig
+	connect := func() runner.Runner {
+		r, err := runner.New(d, runnerConfig, connConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to connect to the database, %s", err.Error())
+			os.Exit(1)
+		}
+
+		return r
+	}
+
+	// migrations in progress are rolled back on interrupt or termination,
+	// a second signal kills the process right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	switch args[0] {
 	case "init":
 		initCmd := flag.NewFlagSet("init", flag.ExitOnError)
 
-		initCmd.Parse(os.Args[2:])
+		initCmd.Parse(args[1:])
+
+		r := connect()
 
 		err := r.Init(ctx)
 		if err != nil {
@@ -67,7 +123,7 @@ func main() {
 		newCmd := flag.NewFlagSet("new", flag.ExitOnError)
 		name := newCmd.String("name", "", "name of migration (required)")
 
-		newCmd.Parse(os.Args[2:])
+		newCmd.Parse(args[1:])
 
 		if *name == "" {
 			fmt.Fprintf(os.Stderr, "name is required\n")
@@ -75,7 +131,9 @@ func main() {
 			os.Exit(1)
 		}
 
-		r.New(ctx, *name)
+		r := connect()
+
+		_, err := r.New(ctx, *name)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
 			os.Exit(1)
@@ -84,7 +142,20 @@ func main() {
 	case "up":
 		upCmd := flag.NewFlagSet("up", flag.ExitOnError)
 		steps := upCmd.Int("steps", -1, "How many ups you want to do (-1 means all) (-1 default)")
-		upCmd.Parse(os.Args[2:])
+		to := upCmd.Int64("to", -1, "Execute migrations up to and including this version (-1 means no limit) (-1 default)")
+		finishRunFlags := addRunFlags(upCmd, &runnerConfig)
+		upCmd.Parse(args[1:])
+
+		err := finishRunFlags()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+
+		if *to >= 0 && isFlagSet(upCmd, "steps") {
+			fmt.Fprintf(os.Stderr, "steps and to can't be used together\n")
+			os.Exit(1)
+		}
 
 		if *steps == 0 {
 			fmt.Fprintf(os.Stderr, "steps is invalid, it can be -1, or some positive number, but its %d\n", *steps)
@@ -96,7 +167,14 @@ func main() {
 			os.Exit(1)
 		}
 
-		err := r.Up(ctx, *steps)
+		r := connect()
+
+		if *to >= 0 {
+			err = r.UpTo(ctx, *to)
+		} else {
+			err = r.Up(ctx, *steps)
+		}
+
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to execute up migrations, %s\n", err.Error())
 			os.Exit(1)
@@ -105,7 +183,20 @@ func main() {
 	case "down":
 		downCmd := flag.NewFlagSet("down", flag.ExitOnError)
 		steps := downCmd.Int("steps", 1, "How many downs you want to do (-1 means all) (1 default)")
-		downCmd.Parse(os.Args[2:])
+		to := downCmd.Int64("to", -1, "Roll back migrations after this version, 0 rolls back all (-1 means no limit) (-1 default)")
+		finishRunFlags := addRunFlags(downCmd, &runnerConfig)
+		downCmd.Parse(args[1:])
+
+		err := finishRunFlags()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+
+		if *to >= 0 && isFlagSet(downCmd, "steps") {
+			fmt.Fprintf(os.Stderr, "steps and to can't be used together\n")
+			os.Exit(1)
+		}
 
 		if *steps == 0 {
 			fmt.Fprintf(os.Stderr, "steps is invalid, it can be -1, or some positive number, but its %d\n", *steps)
@@ -117,15 +208,196 @@ func main() {
 			os.Exit(1)
 		}
 
-		err := r.Down(ctx, *steps)
+		r := connect()
+
+		if *to >= 0 {
+			err = r.DownTo(ctx, *to)
+		} else {
+			err = r.Down(ctx, *steps)
+		}
+
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to execute down migrations, %s\n", err.Error())
 			os.Exit(1)
 		}
 
+	case "goto":
+		gotoCmd := flag.NewFlagSet("goto", flag.ExitOnError)
+		gotoCmd.Usage = func() {
+			fmt.Fprintf(gotoCmd.Output(), "Usage: goto [flags] <version>\n")
+			gotoCmd.PrintDefaults()
+		}
+		finishRunFlags := addRunFlags(gotoCmd, &runnerConfig)
+		gotoCmd.Parse(args[1:])
+
+		err := finishRunFlags()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+
+		if gotoCmd.NArg() != 1 {
+			gotoCmd.Usage()
+			os.Exit(1)
+		}
+
+		version, err := strconv.ParseInt(gotoCmd.Arg(0), 10, 64)
+		if err != nil || version < 0 {
+			fmt.Fprintf(os.Stderr, "version is invalid, it has to be a migration timestamp or 0, but its %s\n", gotoCmd.Arg(0))
+			os.Exit(1)
+		}
+
+		r := connect()
+
+		err = r.MigrateTo(ctx, version)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to migrate to version %d, %s\n", version, err.Error())
+			os.Exit(1)
+		}
+
+	case "redo":
+		redoCmd := flag.NewFlagSet("redo", flag.ExitOnError)
+		steps := redoCmd.Int("steps", 1, "How many of the last executed migrations to roll back and execute again (1 default)")
+		finishRunFlags := addRunFlags(redoCmd, &runnerConfig)
+		redoCmd.Parse(args[1:])
+
+		err := finishRunFlags()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+
+		if *steps <= 0 {
+			fmt.Fprintf(os.Stderr, "steps is invalid, it has to be a positive number, but its %d\n", *steps)
+			os.Exit(1)
+		}
+
+		r := connect()
+
+		err = r.Redo(ctx, *steps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to redo migrations, %s\n", err.Error())
+			os.Exit(1)
+		}
+
+	case "baseline":
+		baselineCmd := flag.NewFlagSet("baseline", flag.ExitOnError)
+		version := baselineCmd.Int64("version", 0, "Mark migrations up to and including this version as executed (required)")
+		baselineCmd.DurationVar(&runnerConfig.LockWaitTimeout, "lock-wait", runnerConfig.LockWaitTimeout, "How long to wait for other processes running migrations (0 means wait forever)")
+		baselineCmd.Parse(args[1:])
+
+		if *version <= 0 {
+			fmt.Fprintf(os.Stderr, "version is required\n")
+			baselineCmd.Usage()
+			os.Exit(1)
+		}
+
+		r := connect()
+
+		err := r.Baseline(ctx, *version)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to baseline migrations, %s\n", err.Error())
+			os.Exit(1)
+		}
+
+	case "force":
+		forceCmd := flag.NewFlagSet("force", flag.ExitOnError)
+		version := forceCmd.Int64("version", 0, "Version of the migration to change (required)")
+		applied := forceCmd.Bool("applied", false, "Mark the migration as executed")
+		pending := forceCmd.Bool("pending", false, "Mark the migration as not executed")
+		forceCmd.DurationVar(&runnerConfig.LockWaitTimeout, "lock-wait", runnerConfig.LockWaitTimeout, "How long to wait for other processes running migrations (0 means wait forever)")
+		forceCmd.Parse(args[1:])
+
+		if *version <= 0 {
+			fmt.Fprintf(os.Stderr, "version is required\n")
+			forceCmd.Usage()
+			os.Exit(1)
+		}
+
+		if *applied == *pending {
+			fmt.Fprintf(os.Stderr, "exactly one of applied and pending is required\n")
+			forceCmd.Usage()
+			os.Exit(1)
+		}
+
+		r := connect()
+
+		err := r.Force(ctx, *version, *applied, currentUser())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to force migration, %s\n", err.Error())
+			os.Exit(1)
+		}
+
+	case "status":
+		statusCmd := flag.NewFlagSet("status", flag.ExitOnError)
+		asJSON := statusCmd.Bool("json", false, "Print status as JSON instead of a table")
+		statusCmd.Parse(args[1:])
+
+		r := connect()
+
+		statuses, err := r.Status(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to get migrations status, %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		if *asJSON {
+			err = printStatusJSON(os.Stdout, statuses)
+		} else {
+			err = printStatusTable(os.Stdout, statuses)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to print migrations status, %s\n", err.Error())
+			os.Exit(1)
+		}
+
+	case "verify":
+		verifyCmd := flag.NewFlagSet("verify", flag.ExitOnError)
+		verifyCmd.Parse(args[1:])
+
+		r := connect()
+
+		err := r.Verify(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			os.Exit(1)
+		}
+
+		fmt.Println("all applied migrations match their checksums")
+
+	case "repair":
+		repairCmd := flag.NewFlagSet("repair", flag.ExitOnError)
+		repairCmd.Parse(args[1:])
+
+		r := connect()
+
+		repaired, err := r.Repair(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to repair checksums, %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		fmt.Printf("updated checksums of %d migration(s)\n", repaired)
+
 	default:
-		fmt.Printf("Unknown subcommand: %s\n", os.Args[1])
-		fmt.Println("Available subcommands: init, new, up, down")
+		fmt.Printf("Unknown subcommand: %s\n", args[0])
+		fmt.Println("Available subcommands: init, new, up, down, goto, redo, baseline, force, status, verify, repair")
 		os.Exit(1)
 	}
 }
+
+// currentUser returns user@host of the process, recorded by force.
+func currentUser() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return name + "@" + host
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github/DusanDjordjic/go-migrate/pkg/runner"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func printStatusJSON(w io.Writer, statuses []runner.MigrationStatus) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(statuses)
+}
+
+func printStatusTable(w io.Writer, statuses []runner.MigrationStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATE\tEXECUTED AT\tROLLED BACK AT\tFLAGS")
+	for _, s := range statuses {
+		state := "pending"
+		if s.Applied {
+			state = "applied"
+		}
+
+		flags := make([]string, 0, 2)
+		if s.Dirty {
+			// errors include the failed query, the first line is enough here
+			reason, _, _ := strings.Cut(s.LastError, "\n")
+			flags = append(flags, "dirty: "+reason)
+		}
+		if s.FileMissing {
+			flags = append(flags, "file missing")
+		}
+		if s.NotRegistered {
+			flags = append(flags, "not registered")
+		}
+		if len(s.ForcedBy) > 0 {
+			flags = append(flags, fmt.Sprintf("forced by %s at %s", s.ForcedBy, formatStatusTime(s.ForcedAt)))
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			s.Version,
+			s.Name,
+			state,
+			formatStatusTime(s.ExecutedAt),
+			formatStatusTime(s.RolledBackAt),
+			strings.Join(flags, ", "),
+		)
+	}
+
+	return tw.Flush()
+}
+
+func formatStatusTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+
+	return t.Format(time.DateTime)
+}
@@ -0,0 +1,177 @@
+// Package gomigrate runs migrations from Go programs, using a database pool
+// the program already opened. A service can run its migrations on startup:
+//
+//	//go:embed migrations/*.sql
+//	var migrationFiles embed.FS
+//
+//	func migrate(ctx context.Context, db *sql.DB) error {
+//		files, err := fs.Sub(migrationFiles, "migrations")
+//		if err != nil {
+//			return err
+//		}
+//
+//		m, err := gomigrate.New(db,
+//			gomigrate.WithDriver("postgres"),
+//			gomigrate.WithFS(files),
+//			gomigrate.WithLogger(log.Default()),
+//		)
+//		if err != nil {
+//			return err
+//		}
+//
+//		err = m.Init(ctx)
+//		if err != nil {
+//			return err
+//		}
+//
+//		return m.Up(ctx, gomigrate.UnlimitedSteps)
+//	}
+//
+// Migrations run on a connection of their own that holds the migrations
+// lock, taken from the *sql.DB passed to New. NewWithConn uses a connection
+// of the caller instead and NewWithExecutor can run migrations in a
+// transaction of the caller, without the lock. The mysql driver needs
+// parseTime=true and multiStatements=true in the DSN of the pool.
+package gomigrate
+
+import (
+	"database/sql"
+	"errors"
+	"github/DusanDjordjic/go-migrate/pkg/driver"
+	"github/DusanDjordjic/go-migrate/pkg/runner"
+)
+
+// ErrNoDB is returned by operations that execute migrations on a Migrator
+// created with NewWithExecutor and an executor that is not a *sql.DB or a
+// *sql.Tx.
+var ErrNoDB = runner.ErrNoDB
+
+// UnlimitedSteps makes Up and Down execute all migrations.
+const UnlimitedSteps = runner.UnlimitedSteps
+
+const (
+	DefaultTable  = "migrations"
+	DefaultSchema = "public"
+	DefaultDir    = "migrations"
+)
+
+type (
+	Hooks          = runner.Hooks
+	MigrationEvent = runner.MigrationEvent
+	TxMode         = runner.TxMode
+	// up or down part of a migration written in Go
+	GoMigrationFunc = runner.GoMigrationFunc
+)
+
+const (
+	TxModeBatch     = runner.TxModeBatch
+	TxModeMigration = runner.TxModeMigration
+	TxModeNone      = runner.TxModeNone
+)
+
+// RegisterGoMigration registers a migration written in Go, it is tracked
+// and ordered with migration files by version. See
+// runner.RegisterGoMigration.
+func RegisterGoMigration(version int64, name string, up, down GoMigrationFunc) {
+	runner.RegisterGoMigration(version, name, up, down)
+}
+
+// Migrator runs migrations on the database passed to New, it has all the
+// methods of runner.Runner.
+type Migrator struct {
+	runner.Runner
+}
+
+type options struct {
+	driver     driver.Driver
+	driverName string
+	config     runner.Config
+	connConfig driver.ConnectionConfig
+}
+
+// New creates a Migrator that runs migrations on db. WithDriver is
+// required, other options have defaults: migrations are read from the
+// "migrations" folder, tracked in the "migrations" table and progress is
+// printed to os.Stdout.
+func New(db *sql.DB, opts ...Option) (*Migrator, error) {
+	if db == nil {
+		return nil, errors.New("gomigrate: db is nil")
+	}
+
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		Runner: runner.NewWithDB(o.driver, db, o.config, o.connConfig),
+	}, nil
+}
+
+// NewWithConn creates a Migrator that runs migrations on conn, holding the
+// migrations lock on it. The caller closes conn. Options are the same as
+// for New.
+func NewWithConn(conn *sql.Conn, opts ...Option) (*Migrator, error) {
+	if conn == nil {
+		return nil, errors.New("gomigrate: conn is nil")
+	}
+
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		Runner: runner.NewWithConn(o.driver, conn, o.config, o.connConfig),
+	}, nil
+}
+
+// NewWithExecutor creates a Migrator that runs queries on exec, usually a
+// transaction the caller already has. Migrations run in the transaction
+// without the migrations lock and the caller commits or rolls it back, so
+// it has to make sure no other process migrates at the same time. Other
+// executors only support Init, Status and Verify, operations that execute
+// migrations return ErrNoDB. See runner.NewWithExecutor. Options are the
+// same as for New.
+func NewWithExecutor(exec driver.Executor, opts ...Option) (*Migrator, error) {
+	if exec == nil {
+		return nil, errors.New("gomigrate: exec is nil")
+	}
+
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		Runner: runner.NewWithExecutor(o.driver, exec, o.config, o.connConfig),
+	}, nil
+}
+
+func newOptions(opts []Option) (options, error) {
+	o := options{
+		config: runner.Config{
+			MigrationsFolder: DefaultDir,
+		},
+		connConfig: driver.ConnectionConfig{
+			Table:  DefaultTable,
+			Schema: DefaultSchema,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.driver != nil {
+		return o, nil
+	}
+
+	if len(o.driverName) == 0 {
+		return o, errors.New("gomigrate: driver is required, use WithDriver")
+	}
+
+	var err error
+	o.driver, err = driver.Open(o.driverName)
+	return o, err
+}
@@ -0,0 +1,132 @@
+package gomigrate
+
+import (
+	"github/DusanDjordjic/go-migrate/pkg/driver"
+	"io"
+	"io/fs"
+	"log"
+	"time"
+)
+
+// Option configures a Migrator created by New.
+type Option func(o *options)
+
+// WithDriver selects a registered driver by name: "postgres", "mysql" or
+// "sqlite3". It has to match the driver db was opened with.
+func WithDriver(name string) Option {
+	return func(o *options) {
+		o.driverName = name
+		o.driver = nil
+	}
+}
+
+// WithCustomDriver uses d instead of a registered driver.
+func WithCustomDriver(d driver.Driver) Option {
+	return func(o *options) {
+		o.driver = d
+	}
+}
+
+// WithTable sets the name of the migrations table.
+func WithTable(table string) Option {
+	return func(o *options) {
+		o.connConfig.Table = table
+	}
+}
+
+// WithSchema sets the schema of the migrations table, used only by
+// postgres.
+func WithSchema(schema string) Option {
+	return func(o *options) {
+		o.connConfig.Schema = schema
+	}
+}
+
+// WithDir reads migrations from dir and creates new migration files in it.
+func WithDir(dir string) Option {
+	return func(o *options) {
+		o.config.MigrationsFolder = dir
+	}
+}
+
+// WithFS reads migrations from fsys, for example an embed.FS. Migration
+// files have to be in its root, use fs.Sub for embedded folders. Init
+// doesn't create a migrations folder and New returns an error, there is no
+// folder to create migration files in.
+func WithFS(fsys fs.FS) Option {
+	return func(o *options) {
+		o.config.FS = fsys
+		o.config.MigrationsFolder = ""
+	}
+}
+
+// WithOutput prints executed migrations and dry run plans to w, use
+// io.Discard to silence the Migrator.
+func WithOutput(w io.Writer) Option {
+	return func(o *options) {
+		o.config.Output = w
+	}
+}
+
+// WithLogger prints executed migrations and dry run plans to logger, every
+// executed migration is a log entry.
+func WithLogger(logger *log.Logger) Option {
+	return func(o *options) {
+		o.config.Output = logWriter{logger}
+	}
+}
+
+// WithHooks calls hooks around every executed migration.
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) {
+		o.config.Hooks = hooks
+	}
+}
+
+// WithTxMode sets how migrations are wrapped in transactions, TxModeBatch
+// by default.
+func WithTxMode(mode TxMode) Option {
+	return func(o *options) {
+		o.config.TxMode = mode
+	}
+}
+
+// WithLockWait sets how long to wait for other processes running
+// migrations, 0 means wait forever.
+func WithLockWait(timeout time.Duration) Option {
+	return func(o *options) {
+		o.config.LockWaitTimeout = timeout
+	}
+}
+
+// WithTimeout sets how long a single migration can run.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.config.Timeout = timeout
+	}
+}
+
+// WithLockTimeout sets how long statements of migrations wait for locks
+// held by other sessions.
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.config.LockTimeout = timeout
+	}
+}
+
+// WithDryRun makes Up and Down only print migrations they would execute.
+func WithDryRun() Option {
+	return func(o *options) {
+		o.config.DryRun = true
+	}
+}
+
+// logWriter writes every line it gets as a log entry.
+type logWriter struct {
+	logger *log.Logger
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.logger.Print(string(p))
+	return len(p), nil
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// expand replaces ${VAR} with the value of the env variable VAR and
+// ${VAR:-default} with default if VAR is not set or empty. $${ is a literal
+// ${, any other $ is kept as it is so passwords with $ don't need escaping.
+func expand(s string) (string, error) {
+	var b strings.Builder
+
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+
+		if start > 0 && s[start-1] == '$' {
+			b.WriteString(s[:start])
+			b.WriteString("{")
+			s = s[start+2:]
+			continue
+		}
+
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("missing } in \"%s\"", s[start:])
+		}
+		end += start
+
+		name, def, hasDefault := strings.Cut(s[start+2:end], ":-")
+		if len(name) == 0 {
+			return "", fmt.Errorf("missing variable name in \"%s\"", s[start:end+1])
+		}
+
+		val, found := os.LookupEnv(name)
+		if hasDefault && len(val) == 0 {
+			val = def
+		} else if !found {
+			return "", fmt.Errorf("variable %s is not set, use ${%s:-} if it can be empty", name, name)
+		}
+
+		b.WriteString(s[:start])
+		b.WriteString(val)
+		s = s[end+1:]
+	}
+}
+
+// readSecretFile reads a value from a file, usually a mounted secret. The
+// trailing new line most editors add is removed.
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	t.Setenv("GO_MIGRATE_TEST_X", "x")
+	t.Setenv("GO_MIGRATE_TEST_EMPTY", "")
+	// Setenv restores the variable after the test
+	t.Setenv("GO_MIGRATE_TEST_UNSET", "")
+	os.Unsetenv("GO_MIGRATE_TEST_UNSET")
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "no variables", in: "postgres://localhost/app", want: "postgres://localhost/app"},
+		{name: "variable", in: "a${GO_MIGRATE_TEST_X}b", want: "axb"},
+		{name: "two variables", in: "${GO_MIGRATE_TEST_X}${GO_MIGRATE_TEST_X}", want: "xx"},
+		{name: "escaped", in: "$${GO_MIGRATE_TEST_X}", want: "${GO_MIGRATE_TEST_X}"},
+		{name: "bare dollar before escaped", in: "a$$${GO_MIGRATE_TEST_X}", want: "a$${GO_MIGRATE_TEST_X}"},
+		{name: "password with dollars", in: "user:p$ss$$w0rd$@host", want: "user:p$ss$$w0rd$@host"},
+		{name: "dollar before brace", in: "a$}b", want: "a$}b"},
+		{name: "default of set", in: "${GO_MIGRATE_TEST_X:-d}", want: "x"},
+		{name: "default of empty", in: "${GO_MIGRATE_TEST_EMPTY:-d}", want: "d"},
+		{name: "default of unset", in: "${GO_MIGRATE_TEST_UNSET:-d}", want: "d"},
+		{name: "empty default of unset", in: "${GO_MIGRATE_TEST_UNSET:-}", want: ""},
+		{name: "default with dollar", in: "${GO_MIGRATE_TEST_UNSET:-p$ss}", want: "p$ss"},
+		{name: "empty", in: "${GO_MIGRATE_TEST_EMPTY}", want: ""},
+		{name: "unset", in: "${GO_MIGRATE_TEST_UNSET}", wantErr: true},
+		{name: "missing name", in: "${:-d}", wantErr: true},
+		{name: "unterminated", in: "${GO_MIGRATE_TEST_X", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expand(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expand(%q) = %q, want an error", tt.in, got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expand(%q): %s", tt.in, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("expand(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetFromFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GO_MIGRATE_TEST_SECRETS", dir)
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "new line", content: "secret\n", want: "secret"},
+		{name: "windows new line", content: "secret\r\n", want: "secret"},
+		{name: "many new lines", content: "secret\n\r\n\n", want: "secret"},
+		{name: "no new line", content: "secret", want: "secret"},
+		{name: "inner new line", content: "sec\nret\n", want: "sec\nret"},
+		{name: "not expanded", content: "${GO_MIGRATE_TEST_SECRETS}", want: "${GO_MIGRATE_TEST_SECRETS}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := os.WriteFile(filepath.Join(dir, "dsn"), []byte(tt.content), 0600)
+			if err != nil {
+				t.Fatalf("failed to write the secret file: %s", err)
+			}
+
+			var conf AppConfig
+
+			err = setFromFile(&conf, DSN_ENV, "${GO_MIGRATE_TEST_SECRETS}/dsn")
+			if err != nil {
+				t.Fatalf("setFromFile: %s", err)
+			}
+
+			if conf.DSN != tt.want {
+				t.Errorf("DSN = %q, want %q", conf.DSN, tt.want)
+			}
+		})
+	}
+}
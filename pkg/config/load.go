@@ -7,27 +7,101 @@ import (
 )
 
 const (
-	DSN_ENV     = "GO_MIGRATE_DSN"
-	DRIVER_ENV  = "GO_MIGRATE_DRIVER"
-	CONFIG_FILE = ".gomigrate"
+	DSN_ENV    = "GO_MIGRATE_DSN"
+	DRIVER_ENV = "GO_MIGRATE_DRIVER"
+	TABLE_ENV  = "GO_MIGRATE_TABLE"
+	SCHEMA_ENV = "GO_MIGRATE_SCHEMA"
+	DIR_ENV    = "GO_MIGRATE_DIR"
+	ENV_ENV    = "GO_MIGRATE_ENV"
+	// sql executed on every new connection
+	INIT_SQL_ENV = "GO_MIGRATE_INIT_SQL"
+	CONFIG_FILE  = ".gomigrate"
+	// config file with named environments. Env variables and CONFIG_FILE
+	// override values of the default environment. When an environment is
+	// selected with ENV_ENV or -env, CONFIG_FILE is ignored and env
+	// variables can't override its DSN and driver
+	CONFIG_YAML_FILE = "gomigrate.yaml"
+	// KEY_FILE reads the value of KEY from a file, for secrets mounted as
+	// files
+	FILE_SUFFIX = "_FILE"
 )
 
+const (
+	DEFAULT_TABLE  = "migrations"
+	DEFAULT_SCHEMA = "public"
+	DEFAULT_DIR    = "migrations"
+)
+
+// keys that can be set by env and CONFIG_FILE, values can reference env
+// variables with ${VAR} and ${VAR:-default}
+var keys = []string{DSN_ENV, DRIVER_ENV, TABLE_ENV, SCHEMA_ENV, DIR_ENV, INIT_SQL_ENV}
+
+// Load loads the config with the environment selected by ENV_ENV.
 func Load() (AppConfig, error) {
-	conf := AppConfig{}
+	return LoadEnvironment(os.Getenv(ENV_ENV))
+}
 
-	dsn, err := loadEnv(DSN_ENV)
-	if err == nil {
-		conf.DSN = dsn
+// LoadEnvironment loads the config with the environment env from
+// CONFIG_YAML_FILE, or its default environment if env is empty. An
+// explicitly selected environment is never redirected to another database
+// by CONFIG_FILE or env variables.
+func LoadEnvironment(env string) (AppConfig, error) {
+	conf := AppConfig{
+		Table:            DEFAULT_TABLE,
+		Schema:           DEFAULT_SCHEMA,
+		MigrationsFolder: DEFAULT_DIR,
 	}
 
-	driver, err := loadEnv(DRIVER_ENV)
-	if err == nil {
-		conf.Driver = driver
+	foundYAML, err := loadYAML(&conf, env)
+	if err != nil {
+		return conf, err
+	}
+
+	for _, key := range keys {
+		path, fileErr := loadEnv(key + FILE_SUFFIX)
+		val, err := loadEnv(key)
+
+		if fileErr == nil && err == nil {
+			return conf, fmt.Errorf("%s and %s can't be used together", key, key+FILE_SUFFIX)
+		}
+
+		// DSN and driver have no defaults, they are set only by the environment
+		explicit := len(env) > 0 && (key == DSN_ENV || key == DRIVER_ENV)
+		if explicit && (fileErr == nil || err == nil) && len(*field(&conf, key)) > 0 {
+			return conf, fmt.Errorf("%s is set, but environment \"%s\" in %s already sets it, unset one of them", key, env, CONFIG_YAML_FILE)
+		}
+
+		if fileErr == nil {
+			err = setFromFile(&conf, key, path)
+		} else if err == nil {
+			err = set(&conf, key, val)
+		} else {
+			continue
+		}
+
+		if err != nil {
+			return conf, err
+		}
+	}
+
+	if len(env) > 0 {
+		if _, err := os.Stat(CONFIG_FILE); err == nil {
+			fmt.Fprintf(os.Stderr, "warning: ignoring config file %s, environment \"%s\" is selected\n", CONFIG_FILE, env)
+		}
+
+		if err := conf.Check(); err != nil {
+			return conf, err
+		}
+
+		return conf, nil
 	}
 
 	fileContent, err := os.ReadFile(CONFIG_FILE)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "warning: failed to read config file %s, %s", CONFIG_FILE, err.Error())
+		if !foundYAML {
+			fmt.Fprintf(os.Stderr, "warning: failed to read config file %s, %s", CONFIG_FILE, err.Error())
+		}
+
 		if conf.Check() == nil {
 			return conf, nil
 		}
@@ -47,13 +121,17 @@ func Load() (AppConfig, error) {
 			continue
 		}
 
-		switch key {
-		case DSN_ENV:
-			conf.DSN = val
-		case DRIVER_ENV:
-			conf.Driver = val
-		default:
+		if field(&conf, key) != nil {
+			err = set(&conf, key, val)
+		} else if name, ok := strings.CutSuffix(key, FILE_SUFFIX); ok && field(&conf, name) != nil {
+			err = setFromFile(&conf, name, val)
+		} else {
 			fmt.Fprintf(os.Stderr, "warning: invalid variable at %d. line", index)
+			continue
+		}
+
+		if err != nil {
+			return conf, fmt.Errorf("%s:%d: %w", CONFIG_FILE, index+1, err)
 		}
 	}
 
@@ -64,10 +142,58 @@ func Load() (AppConfig, error) {
 	return conf, nil
 }
 
+// field returns the config field set by key, or nil if the key is unknown.
+func field(conf *AppConfig, key string) *string {
+	switch key {
+	case DSN_ENV:
+		return &conf.DSN
+	case DRIVER_ENV:
+		return &conf.Driver
+	case TABLE_ENV:
+		return &conf.Table
+	case SCHEMA_ENV:
+		return &conf.Schema
+	case DIR_ENV:
+		return &conf.MigrationsFolder
+	case INIT_SQL_ENV:
+		return &conf.SQLToExecOnStart
+	default:
+		return nil
+	}
+}
+
+// set sets the field of key to val with env variables expanded.
+func set(conf *AppConfig, key, val string) error {
+	expanded, err := expand(val)
+	if err != nil {
+		return fmt.Errorf("failed to expand %s, %w", key, err)
+	}
+
+	*field(conf, key) = expanded
+	return nil
+}
+
+// setFromFile sets the field of key to the content of the file at path,
+// env variables are expanded only in the path.
+func setFromFile(conf *AppConfig, key, path string) error {
+	path, err := expand(path)
+	if err != nil {
+		return fmt.Errorf("failed to expand %s, %w", key+FILE_SUFFIX, err)
+	}
+
+	val, err := readSecretFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s, %w", key+FILE_SUFFIX, err)
+	}
+
+	*field(conf, key) = val
+	return nil
+}
+
 func loadEnv(name string) (string, error) {
 	s := os.Getenv(name)
 	if len(s) == 0 {
-		return "", fmt.Errorf("missing %s dsn env", name)
+		return "", fmt.Errorf("missing %s env", name)
 	}
 
 	return s, nil
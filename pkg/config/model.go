@@ -1,13 +1,29 @@
 package config
 
-import "fmt"
-
-var AVAILABLE_DRIVERS = [...]string{"postgres"}
+import (
+	"fmt"
+	"github/DusanDjordjic/go-migrate/pkg/driver"
+	"slices"
+	"time"
+)
 
 type AppConfig struct {
-	DSN              string
-	Driver           string
+	DSN    string
+	Driver string
+	// sql executed on every new connection
 	SQLToExecOnStart string
+	// name of the migrations table
+	Table string
+	// schema of the migrations table, used only by postgres
+	Schema string
+	// folder with migration files
+	MigrationsFolder string
+	// environment selected from CONFIG_YAML_FILE, empty without the file
+	Environment string
+	// default transaction mode of the environment
+	TxMode string
+	// default time to wait for other processes running migrations
+	LockWait time.Duration
 }
 
 func (app *AppConfig) Check() error {
@@ -19,16 +35,17 @@ func (app *AppConfig) Check() error {
 		return fmt.Errorf("failed to load %s", DRIVER_ENV)
 	}
 
-	found := false
-	for _, d := range AVAILABLE_DRIVERS {
-		if app.Driver == d {
-			found = true
-			break
-		}
+	if len(app.Table) == 0 {
+		return fmt.Errorf("%s can't be empty", TABLE_ENV)
+	}
+
+	if len(app.MigrationsFolder) == 0 {
+		return fmt.Errorf("%s can't be empty", DIR_ENV)
 	}
 
-	if !found {
-		return fmt.Errorf("driver \"%s\" is not supported yet", app.Driver)
+	available := driver.Drivers()
+	if !slices.Contains(available, app.Driver) {
+		return fmt.Errorf("driver \"%s\" is not supported, supported drivers %v", app.Driver, available)
 	}
 
 	return nil
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlFile is the structure of gomigrate.yaml, for example
+//
+//	default: dev
+//	environments:
+//	  dev:
+//	    driver: postgres
+//	    dsn: postgres://localhost/app_dev?sslmode=disable
+//	  prod:
+//	    driver: postgres
+//	    dsn: postgres://db.internal/app
+//	    schema: app
+//	    table: schema_migrations
+//	    dir: db/migrations
+//	    init_sql: SET lock_timeout = '5s'
+//	    options:
+//	      tx: migration
+//	      lock_wait: 1m
+type yamlFile struct {
+	// environment used when none is selected
+	Default      string                     `yaml:"default"`
+	Environments map[string]yamlEnvironment `yaml:"environments"`
+}
+
+type yamlEnvironment struct {
+	DSN     string      `yaml:"dsn"`
+	Driver  string      `yaml:"driver"`
+	Schema  string      `yaml:"schema"`
+	Table   string      `yaml:"table"`
+	Dir     string      `yaml:"dir"`
+	InitSQL string      `yaml:"init_sql"`
+	Options yamlOptions `yaml:"options"`
+}
+
+type yamlOptions struct {
+	// transaction mode: batch, migration or none
+	TxMode   string `yaml:"tx"`
+	LockWait string `yaml:"lock_wait"`
+}
+
+// loadYAML loads the environment env from CONFIG_YAML_FILE, or its default
+// environment if env is empty. It reports false if the file doesn't exist.
+func loadYAML(conf *AppConfig, env string) (bool, error) {
+	content, err := os.ReadFile(CONFIG_YAML_FILE)
+	if errors.Is(err, fs.ErrNotExist) {
+		if len(env) > 0 {
+			return false, fmt.Errorf("environment \"%s\" selected but there is no %s config file", env, CONFIG_YAML_FILE)
+		}
+
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to read config file %s, %w", CONFIG_YAML_FILE, err)
+	}
+
+	var file yamlFile
+	err = yaml.Unmarshal(content, &file)
+	if err != nil {
+		return true, fmt.Errorf("failed to parse config file %s, %w", CONFIG_YAML_FILE, err)
+	}
+
+	if len(env) == 0 {
+		env = file.Default
+	}
+
+	if len(env) == 0 {
+		return true, fmt.Errorf("no environment selected in %s, use -env, %s or set default", CONFIG_YAML_FILE, ENV_ENV)
+	}
+
+	e, found := file.Environments[env]
+	if !found {
+		names := make([]string, 0, len(file.Environments))
+		for name := range file.Environments {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		return true, fmt.Errorf("environment \"%s\" is not in %s, available environments %v", env, CONFIG_YAML_FILE, names)
+	}
+
+	conf.Environment = env
+
+	values := []*string{&e.DSN, &e.Driver, &e.Schema, &e.Table, &e.Dir, &e.InitSQL, &e.Options.TxMode, &e.Options.LockWait}
+	for _, val := range values {
+		*val, err = expand(*val)
+		if err != nil {
+			return true, fmt.Errorf("environment \"%s\" in %s: %w", env, CONFIG_YAML_FILE, err)
+		}
+	}
+
+	if len(e.DSN) > 0 {
+		conf.DSN = e.DSN
+	}
+
+	if len(e.Driver) > 0 {
+		conf.Driver = e.Driver
+	}
+
+	if len(e.Schema) > 0 {
+		conf.Schema = e.Schema
+	}
+
+	if len(e.Table) > 0 {
+		conf.Table = e.Table
+	}
+
+	if len(e.Dir) > 0 {
+		conf.MigrationsFolder = e.Dir
+	}
+
+	if len(e.InitSQL) > 0 {
+		conf.SQLToExecOnStart = e.InitSQL
+	}
+
+	conf.TxMode = e.Options.TxMode
+
+	if len(e.Options.LockWait) > 0 {
+		conf.LockWait, err = time.ParseDuration(e.Options.LockWait)
+		if err != nil {
+			return true, fmt.Errorf("environment \"%s\" in %s has invalid lock_wait, %w", env, CONFIG_YAML_FILE, err)
+		}
+	}
+
+	return true, nil
+}
@@ -2,7 +2,9 @@ package driver
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"strconv"
 	"time"
 )
@@ -11,15 +13,43 @@ type ConnectionConfig struct {
 	DSN string
 	// name of the migrations table
 	Table string
-	// schema name, used only by postgres
+	// schema name, used only by postgres. mysql uses the database from DSN
 	Schema string
+	// sql executed on every new connection, for session settings like
+	// SET search_path or SET role
+	InitSQL string
 }
 
 type Migration struct {
-	ID        uint
-	CreatedAt time.Time
-	Name      string
-	Executed  Executed
+	ID           uint
+	CreatedAt    time.Time
+	Name         string
+	Executed     Executed
+	ExecutedAt   *time.Time
+	RolledBackAt *time.Time
+	// sha256 of the up migration at the time it was executed, empty for
+	// migrations executed before checksums were recorded
+	Checksum string
+	// who and when last changed the executed flag by hand, see Driver.Force
+	ForcedBy string
+	ForcedAt *time.Time
+	// set when the migration failed outside of a transaction and the schema
+	// may be half migrated, cleared by Up, Down, Mark and Force
+	Dirty     bool
+	LastError string
+}
+
+// column is a column added to the migrations table after the table was
+// first released. CreateMigrationsTable adds it to existing tables.
+type column struct {
+	name       string
+	definition string
+}
+
+// Checksum returns hex encoded sha256 of the migration's sql.
+func Checksum(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(sum[:])
 }
 
 type (
@@ -38,6 +68,25 @@ func (exe Executed) Bool() bool {
 	}
 }
 
+// updatedAtColumn returns the column that records when a migration was
+// executed or rolled back.
+func updatedAtColumn(executed Executed) string {
+	if executed.Bool() {
+		return "executed_at"
+	}
+
+	return "rolled_back_at"
+}
+
+func nullTimeToPtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+
+	utc := t.Time.UTC()
+	return &utc
+}
+
 const (
 	ExecutedYes   Executed  = 1
 	ExecutedNo    Executed  = 0
@@ -56,14 +105,91 @@ type Executor interface {
 
 type Driver interface {
 	Conn(config ConnectionConfig) (*sql.DB, error)
+	// Sets the config like Conn, but without opening a database, used with
+	// databases opened by the caller
+	Configure(config ConnectionConfig)
+	// Creates the migrations table if it doesn't exist and adds columns
+	// that are missing from tables created by older versions. The runner
+	// calls it for existing tables before every operation that reads them
 	CreateMigrationsTable(ctx context.Context, exec Executor) error
 	HasMigrationTable(ctx context.Context, exec Executor) (bool, error)
 	// Gets migrations from database, sorted by time of creation
 	GetMigrations(ctx context.Context, exec Executor, executed Executed, direction Direction) ([]Migration, error)
 	// Adds a new migration to a database and sets it's executed flag to false by default
 	AddMigration(ctx context.Context, exec Executor, name string, ts time.Time) error
-	// Executed a migration and updates the migration setting executed to true
+	// Executed a migration and updates the migration setting executed to true,
+	// recording the checksum of sql and clearing the dirty flag
 	Up(ctx context.Context, exec Executor, name, sql string) error
 	// Executed a migration and updates the migration setting executed to false
+	// and clearing the dirty flag
 	Down(ctx context.Context, exec Executor, name, sql string) error
+	// Sets the executed flag of a migration and executed_at or rolled_back_at
+	// without executing the migration
+	Mark(ctx context.Context, exec Executor, name string, executed Executed) error
+	// Same as Mark, but it also records who changed the migration and when,
+	// used to fix the state by hand after a failed migration
+	Force(ctx context.Context, exec Executor, name string, executed Executed, by string) error
+	// Marks a migration that failed outside of a transaction as dirty and
+	// records why it failed
+	MarkDirty(ctx context.Context, exec Executor, name, reason string) error
+	// Sets the recorded checksum of a migration without executing it
+	SetChecksum(ctx context.Context, exec Executor, name, checksum string) error
+	// Acquires a lock on conn that prevents other processes from running
+	// migrations at the same time. It waits for the lock at most timeout,
+	// 0 means wait until ctx is done. Returns ErrLockTimeout on timeout
+	Lock(ctx context.Context, conn *sql.Conn, timeout time.Duration) error
+	// Releases the lock acquired by Lock, conn must be the same connection
+	Unlock(ctx context.Context, conn *sql.Conn) error
+}
+
+// TimeoutSetter is implemented by drivers that can limit how long
+// statements of a session run and how long they wait for locks held by
+// other sessions. Without it migrations are cancelled only by the context
+// deadline and lock timeouts are ignored.
+type TimeoutSetter interface {
+	// Sets how long a statement can run and how long it can wait for locks
+	// held by other sessions on conn, 0 leaves a timeout unchanged. Returns a
+	// function that restores the previous timeouts
+	SetTimeouts(ctx context.Context, conn *sql.Conn, statement, lock time.Duration) (func(ctx context.Context) error, error)
+}
+
+// StatementTimeoutChecker is implemented by drivers whose SetTimeouts sets
+// a statement timeout enforced by the database.
+type StatementTimeoutChecker interface {
+	// Reports whether err comes from a statement cancelled by the database
+	// because it ran longer than the statement timeout set by SetTimeouts
+	IsStatementTimeout(err error) bool
+}
+
+// TransactionalDDLReporter is implemented by drivers of databases that
+// commit schema changes implicitly, like mysql. Drivers without it are
+// expected to roll back schema changes with their transaction.
+type TransactionalDDLReporter interface {
+	// Reports whether schema changes are rolled back with their transaction
+	TransactionalDDL() bool
+}
+
+// SetTimeouts sets timeouts on conn if d is a TimeoutSetter, the returned
+// function restores them. Other drivers leave the session unchanged.
+func SetTimeouts(ctx context.Context, d Driver, conn *sql.Conn, statement, lock time.Duration) (func(ctx context.Context) error, error) {
+	if setter, ok := d.(TimeoutSetter); ok {
+		return setter.SetTimeouts(ctx, conn, statement, lock)
+	}
+
+	return func(ctx context.Context) error { return nil }, nil
+}
+
+// IsStatementTimeout reports whether err comes from the statement timeout
+// set by SetTimeouts, it is false for drivers without a StatementTimeoutChecker.
+func IsStatementTimeout(d Driver, err error) bool {
+	checker, ok := d.(StatementTimeoutChecker)
+	return ok && checker.IsStatementTimeout(err)
+}
+
+// TransactionalDDL reports whether schema changes of d are rolled back with
+// their transaction, it is true for drivers without a
+// TransactionalDDLReporter.
+func TransactionalDDL(d Driver) bool {
+	reporter, ok := d.(TransactionalDDLReporter)
+	return !ok || reporter.TransactionalDDL()
 }
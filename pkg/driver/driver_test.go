@@ -0,0 +1,182 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// testDriverMigrations runs the migrations table of d through its whole
+// life: creating it, executing and rolling back a migration and changing
+// its state by hand. The migrations table must not exist yet.
+func testDriverMigrations(t *testing.T, db *sql.DB, d Driver) {
+	ctx := context.Background()
+
+	exists, err := d.HasMigrationTable(ctx, db)
+	if err != nil {
+		t.Fatalf("HasMigrationTable: %s", err)
+	}
+	if exists {
+		t.Fatalf("HasMigrationTable = true before the table was created")
+	}
+
+	// the second call goes through adding missing columns to an existing
+	// table
+	for i := 0; i < 2; i++ {
+		err = d.CreateMigrationsTable(ctx, db)
+		if err != nil {
+			t.Fatalf("CreateMigrationsTable call %d: %s", i+1, err)
+		}
+	}
+
+	exists, err = d.HasMigrationTable(ctx, db)
+	if err != nil {
+		t.Fatalf("HasMigrationTable: %s", err)
+	}
+	if !exists {
+		t.Fatalf("HasMigrationTable = false after the table was created")
+	}
+
+	const name = "create_users"
+	const upSql = "SELECT 1"
+	createdAt := time.Unix(1700000000, 0).UTC()
+
+	err = d.AddMigration(ctx, db, name, createdAt)
+	if err != nil {
+		t.Fatalf("AddMigration: %s", err)
+	}
+
+	err = d.Up(ctx, db, name, upSql)
+	if err != nil {
+		t.Fatalf("Up: %s", err)
+	}
+
+	executed, err := d.GetMigrations(ctx, db, ExecutedYes, DirectionAsc)
+	if err != nil {
+		t.Fatalf("GetMigrations: %s", err)
+	}
+	if len(executed) != 1 || executed[0].Name != name {
+		t.Fatalf("GetMigrations after Up = %+v, want only %s", executed, name)
+	}
+	if !executed[0].CreatedAt.Equal(createdAt) {
+		t.Errorf("CreatedAt = %s, want %s", executed[0].CreatedAt, createdAt)
+	}
+	if executed[0].Checksum != Checksum(upSql) {
+		t.Errorf("Checksum = %s, want %s", executed[0].Checksum, Checksum(upSql))
+	}
+	if executed[0].ExecutedAt == nil {
+		t.Errorf("ExecutedAt is not set after Up")
+	}
+
+	err = d.Down(ctx, db, name, "SELECT 2")
+	if err != nil {
+		t.Fatalf("Down: %s", err)
+	}
+
+	pending, err := d.GetMigrations(ctx, db, ExecutedNo, DirectionDesc)
+	if err != nil {
+		t.Fatalf("GetMigrations: %s", err)
+	}
+	if len(pending) != 1 || pending[0].Name != name {
+		t.Fatalf("GetMigrations after Down = %+v, want only %s", pending, name)
+	}
+	if pending[0].RolledBackAt == nil {
+		t.Errorf("RolledBackAt is not set after Down")
+	}
+
+	testDriverState(t, db, d, name)
+}
+
+// testDriverState checks Mark, MarkDirty and Force on the pending migration
+// name.
+func testDriverState(t *testing.T, db *sql.DB, d Driver, name string) {
+	ctx := context.Background()
+
+	get := func() Migration {
+		t.Helper()
+
+		for _, executed := range [...]Executed{ExecutedYes, ExecutedNo} {
+			migrations, err := d.GetMigrations(ctx, db, executed, DirectionAsc)
+			if err != nil {
+				t.Fatalf("GetMigrations: %s", err)
+			}
+
+			for _, m := range migrations {
+				if m.Name == name {
+					return m
+				}
+			}
+		}
+
+		t.Fatalf("migration %s is not in the migrations table", name)
+		return Migration{}
+	}
+
+	err := d.Mark(ctx, db, name, ExecutedYes)
+	if err != nil {
+		t.Fatalf("Mark: %s", err)
+	}
+	if m := get(); m.Executed != ExecutedYes {
+		t.Errorf("Executed = %d after Mark, want %d", m.Executed, ExecutedYes)
+	}
+
+	const reason = "syntax error"
+
+	err = d.MarkDirty(ctx, db, name, reason)
+	if err != nil {
+		t.Fatalf("MarkDirty: %s", err)
+	}
+	if m := get(); !m.Dirty || m.LastError != reason {
+		t.Errorf("Dirty, LastError = %t, %q after MarkDirty, want true, %q", m.Dirty, m.LastError, reason)
+	}
+
+	const by = "dev@host"
+
+	err = d.Force(ctx, db, name, ExecutedNo, by)
+	if err != nil {
+		t.Fatalf("Force: %s", err)
+	}
+
+	m := get()
+	if m.Executed != ExecutedNo {
+		t.Errorf("Executed = %d after Force, want %d", m.Executed, ExecutedNo)
+	}
+	if m.Dirty || len(m.LastError) > 0 {
+		t.Errorf("Dirty, LastError = %t, %q after Force, want false, \"\"", m.Dirty, m.LastError)
+	}
+	if m.ForcedBy != by || m.ForcedAt == nil {
+		t.Errorf("ForcedBy, ForcedAt = %q, %v after Force, want %q and a time", m.ForcedBy, m.ForcedAt, by)
+	}
+}
+
+// plainDriver implements only the required methods of Driver.
+type plainDriver struct {
+	Driver
+}
+
+func TestOptionalInterfaceDefaults(t *testing.T) {
+	d := plainDriver{}
+
+	restore, err := SetTimeouts(context.Background(), d, nil, time.Second, time.Second)
+	if err != nil {
+		t.Fatalf("SetTimeouts: %s", err)
+	}
+
+	err = restore(context.Background())
+	if err != nil {
+		t.Fatalf("restore: %s", err)
+	}
+
+	if IsStatementTimeout(d, context.DeadlineExceeded) {
+		t.Errorf("IsStatementTimeout = true for a driver without StatementTimeoutChecker")
+	}
+
+	if !TransactionalDDL(d) {
+		t.Errorf("TransactionalDDL = false for a driver without TransactionalDDLReporter")
+	}
+
+	if TransactionalDDL(NewMySQLDriver()) {
+		t.Errorf("TransactionalDDL of mysql = true")
+	}
+}
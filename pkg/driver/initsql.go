@@ -0,0 +1,76 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// openDB opens a database like sql.Open, initSQL runs on every new
+// connection of the pool so session settings like search_path apply to all
+// of them.
+func openDB(driverName, dsn, initSQL string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil || len(initSQL) == 0 {
+		return db, err
+	}
+
+	// sql.Open doesn't connect, it is only used to find the driver
+	drv := db.Driver()
+	db.Close()
+
+	var connector sqldriver.Connector = dsnConnector{dsn: dsn, driver: drv}
+	if dc, ok := drv.(sqldriver.DriverContext); ok {
+		connector, err = dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sql.OpenDB(initSQLConnector{Connector: connector, initSQL: initSQL}), nil
+}
+
+// dsnConnector is a connector for drivers that don't implement
+// DriverContext.
+type dsnConnector struct {
+	dsn    string
+	driver sqldriver.Driver
+}
+
+func (c dsnConnector) Connect(ctx context.Context) (sqldriver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() sqldriver.Driver {
+	return c.driver
+}
+
+// initSQLConnector runs initSQL on connections before they are added to the
+// pool.
+type initSQLConnector struct {
+	sqldriver.Connector
+	initSQL string
+}
+
+func (c initSQLConnector) Connect(ctx context.Context) (sqldriver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(sqldriver.ExecerContext)
+	if !ok {
+		conn.Close()
+		return nil, errors.New("failed to run init sql, driver can't execute queries on a connection")
+	}
+
+	_, err = execer.ExecContext(ctx, c.initSQL, nil)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to run init sql, %w", err)
+	}
+
+	return conn, nil
+}
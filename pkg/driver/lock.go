@@ -0,0 +1,65 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// ErrLockTimeout is returned by Lock when the lock wasn't acquired in time.
+var ErrLockTimeout = errors.New("timed out waiting for the migrations lock")
+
+// ErrStaleLock is returned by Lock when the lock is held by a process that
+// is no longer running and has to be released by hand.
+var ErrStaleLock = errors.New("migrations lock is held by a process that is no longer running")
+
+// how often drivers without blocking locks retry to acquire the lock
+const lockRetryInterval = 500 * time.Millisecond
+
+// lockID returns a stable id of the lock that guards the migrations table.
+func lockID(schemaname, tablename string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("go-migrate:" + schemaname + "." + tablename))
+	return int64(h.Sum64())
+}
+
+// pollLock calls try until it acquires the lock, ctx is done or timeout
+// expires. timeout of 0 means wait until ctx is done.
+func pollLock(ctx context.Context, timeout time.Duration, try func(ctx context.Context) (bool, error)) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	for {
+		locked, err := try(ctx)
+		if err != nil {
+			return lockError(ctx, err)
+		}
+
+		if locked {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return lockError(ctx, ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+func lockError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrLockTimeout
+	}
+
+	if errors.Is(err, ErrStaleLock) {
+		return err
+	}
+
+	return fmt.Errorf("failed to acquire the migrations lock, %w", err)
+}
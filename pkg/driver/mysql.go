@@ -0,0 +1,486 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlQuoteIdentifier quotes a table or column name, so names with dashes,
+// backticks or keywords like order work.
+func mysqlQuoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func mysqlCreateMigrationTableSql(tablename string) string {
+	return fmt.Sprintf(mysqlCreateMigrationsTable, mysqlQuoteIdentifier(tablename))
+}
+
+func mysqlGetMigrationsSql(tablename string, executed Executed, direction Direction) string {
+	q := fmt.Sprintf(mysqlGetMigrations, mysqlQuoteIdentifier(tablename))
+
+	if executed.Bool() {
+		q += "WHERE executed = TRUE"
+	} else {
+		q += "WHERE executed = FALSE"
+	}
+
+	q += "\n"
+
+	if direction == DirectionDesc {
+		q += "ORDER BY created_at DESC"
+	} else {
+		q += "ORDER BY created_at ASC"
+	}
+
+	return q
+}
+
+func mysqlAddColumnSql(tablename string, c column) string {
+	return fmt.Sprintf(mysqlAddColumn, mysqlQuoteIdentifier(tablename), mysqlQuoteIdentifier(c.name), c.definition)
+}
+
+func mysqlMarkDirtySql(tablename string) string {
+	return fmt.Sprintf(mysqlMarkDirty, mysqlQuoteIdentifier(tablename))
+}
+
+func mysqlForceMigrationSql(tablename string) string {
+	return fmt.Sprintf(mysqlForceMigration, mysqlQuoteIdentifier(tablename))
+}
+
+func mysqlSetChecksumSql(tablename string) string {
+	return fmt.Sprintf(mysqlSetChecksum, mysqlQuoteIdentifier(tablename))
+}
+
+func mysqlInsertMigrationSql(tablename string) string {
+	return fmt.Sprintf(mysqlInsertMigration, mysqlQuoteIdentifier(tablename))
+}
+
+func mysqlUpdateMigrationSql(tablename string, executed Executed) string {
+	return fmt.Sprintf(mysqlUpdateMigration, mysqlQuoteIdentifier(tablename), updatedAtColumn(executed))
+}
+
+const mysqlCreateMigrationsTable = `
+CREATE TABLE IF NOT EXISTS %s (
+	id INT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	name VARCHAR(128) NOT NULL,
+	executed BOOLEAN NOT NULL,
+	executed_at DATETIME NULL DEFAULT NULL,
+	rolled_back_at DATETIME NULL DEFAULT NULL,
+	checksum VARCHAR(64) DEFAULT NULL,
+	forced_by VARCHAR(255) DEFAULT NULL,
+	forced_at DATETIME NULL DEFAULT NULL,
+	dirty BOOLEAN NOT NULL DEFAULT FALSE,
+	last_error TEXT NULL,
+	CONSTRAINT name_unique UNIQUE (name)
+);
+`
+
+// columns added after the first release of mysqlCreateMigrationsTable
+var mysqlAddedColumns = [...]column{
+	{name: "checksum", definition: "VARCHAR(64) DEFAULT NULL"},
+	{name: "forced_by", definition: "VARCHAR(255) DEFAULT NULL"},
+	{name: "forced_at", definition: "DATETIME NULL DEFAULT NULL"},
+	{name: "dirty", definition: "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{name: "last_error", definition: "TEXT NULL"},
+}
+
+const mysqlHasColumn = `
+SELECT EXISTS (
+	SELECT 1
+	FROM information_schema.columns
+	WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?
+);
+`
+
+const mysqlAddColumn = `ALTER TABLE %s ADD COLUMN %s %s`
+
+const mysqlHasMigrationsTable = `
+SELECT EXISTS (
+	SELECT 1
+	FROM information_schema.tables
+	WHERE table_schema = DATABASE() AND table_name = ?
+);
+`
+
+const mysqlGetMigrations = `
+SELECT id, created_at, name, executed, executed_at, rolled_back_at, checksum, forced_by, forced_at, dirty, last_error
+FROM %s
+`
+
+const mysqlInsertMigration = `INSERT INTO %s (name, created_at, executed) VALUES (?, ?, FALSE)`
+
+const mysqlUpdateMigration = `
+UPDATE %s SET executed = ?, %s = ?, dirty = FALSE, last_error = NULL
+WHERE name = ?
+`
+
+const mysqlMarkDirty = `
+UPDATE %s SET dirty = TRUE, last_error = ?
+WHERE name = ?
+`
+
+const mysqlForceMigration = `
+UPDATE %s SET forced_by = ?, forced_at = ?
+WHERE name = ?
+`
+
+const mysqlSetChecksum = `
+UPDATE %s SET checksum = ?
+WHERE name = ?
+`
+
+// GET_LOCK is server wide and lock names are limited to 64 characters, so
+// the name is derived from a hash of the database and the table name
+const mysqlLock = `SELECT GET_LOCK(CONCAT('go-migrate-', SHA1(CONCAT(DATABASE(), '.', ?))), ?)`
+
+const mysqlUnlock = `SELECT RELEASE_LOCK(CONCAT('go-migrate-', SHA1(CONCAT(DATABASE(), '.', ?))))`
+
+const mysqlGetTimeouts = `SELECT @@SESSION.lock_wait_timeout, @@SESSION.innodb_lock_wait_timeout`
+
+const mysqlSetTimeouts = `SET SESSION lock_wait_timeout = ?, SESSION innodb_lock_wait_timeout = ?`
+
+// MySQLDriver stores migrations in a table of the database selected in the
+// DSN. It works with MySQL 8 and MariaDB. Schema from ConnectionConfig is
+// ignored, in MySQL a schema is the database itself.
+type MySQLDriver struct {
+	config ConnectionConfig
+}
+
+var (
+	_ TimeoutSetter            = (*MySQLDriver)(nil)
+	_ TransactionalDDLReporter = (*MySQLDriver)(nil)
+)
+
+func init() {
+	Register("mysql", NewMySQLDriver)
+}
+
+func NewMySQLDriver() Driver {
+	return new(MySQLDriver)
+}
+
+func (d *MySQLDriver) Conn(config ConnectionConfig) (*sql.DB, error) {
+	d.Configure(config)
+
+	mysqlConfig, err := mysql.ParseDSN(config.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dsn, %w", err)
+	}
+
+	// created_at is scanned into time.Time
+	mysqlConfig.ParseTime = true
+	// migration files usually contain more than one statement
+	mysqlConfig.MultiStatements = true
+
+	db, err := openDB("mysql", mysqlConfig.FormatDSN(), config.InitSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database, %w", err)
+	}
+
+	err = db.Ping()
+	if err != nil {
+		return nil, fmt.Errorf("failed to ping database, %w", err)
+	}
+
+	return db, nil
+}
+
+func (d *MySQLDriver) Configure(config ConnectionConfig) {
+	d.config = config
+}
+
+func (d *MySQLDriver) CreateMigrationsTable(ctx context.Context, exec Executor) error {
+	exists, err := d.HasMigrationTable(ctx, exec)
+	if err != nil {
+		return err
+	}
+
+	// CREATE TABLE needs privileges a user that only reads and updates an
+	// existing table may not have
+	if !exists {
+		q := mysqlCreateMigrationTableSql(d.config.Table)
+
+		_, err := exec.ExecContext(ctx, q)
+		if err != nil {
+			return fmt.Errorf("cannot create migrations table, %w\nquery:\n%s\n,", err, q)
+		}
+	}
+
+	for _, c := range mysqlAddedColumns {
+		exists := false
+
+		err := exec.QueryRowContext(ctx, mysqlHasColumn, d.config.Table, c.name).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check if %s column exists, %w\nquery:\n%s\n", c.name, err, mysqlHasColumn)
+		}
+
+		if exists {
+			continue
+		}
+
+		q := mysqlAddColumnSql(d.config.Table, c)
+
+		_, err = exec.ExecContext(ctx, q)
+		if err != nil {
+			return fmt.Errorf("cannot add %s column to migrations table, %w\nquery:\n%s\n,", c.name, err, q)
+		}
+	}
+
+	return nil
+}
+
+func (d *MySQLDriver) HasMigrationTable(ctx context.Context, exec Executor) (bool, error) {
+	exists := false
+
+	res := exec.QueryRowContext(ctx, mysqlHasMigrationsTable, d.config.Table)
+	err := res.Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if %s table exists, %w\nquery:\n%s\n", d.config.Table, err, mysqlHasMigrationsTable)
+	}
+
+	return exists, nil
+}
+
+func (d *MySQLDriver) GetMigrations(ctx context.Context, exec Executor, executed Executed, direction Direction) ([]Migration, error) {
+	q := mysqlGetMigrationsSql(d.config.Table, executed, direction)
+
+	rows, err := exec.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get migrations from %s, %w\nquery:\n%s\n", d.config.Table, err, q)
+	}
+	defer rows.Close()
+
+	migrations, err := d.scanMigrations(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan migrations from %s, %w", d.config.Table, err)
+	}
+
+	return migrations, nil
+}
+
+func (d *MySQLDriver) scanMigrations(rows *sql.Rows) ([]Migration, error) {
+	var migrations []Migration = make([]Migration, 0, 16)
+
+	for rows.Next() {
+		var (
+			m            Migration
+			executedBool bool
+			executedAt   sql.NullTime
+			rolledBackAt sql.NullTime
+			checksum     sql.NullString
+			forcedBy     sql.NullString
+			forcedAt     sql.NullTime
+			lastError    sql.NullString
+		)
+
+		err := rows.Scan(&m.ID, &m.CreatedAt, &m.Name, &executedBool, &executedAt, &rolledBackAt, &checksum, &forcedBy, &forcedAt, &m.Dirty, &lastError)
+		if err != nil {
+			return nil, err
+		}
+
+		if executedBool {
+			m.Executed = ExecutedYes
+		} else {
+			m.Executed = ExecutedNo
+		}
+
+		m.CreatedAt = m.CreatedAt.UTC()
+		m.ExecutedAt = nullTimeToPtr(executedAt)
+		m.RolledBackAt = nullTimeToPtr(rolledBackAt)
+		m.Checksum = checksum.String
+		m.ForcedBy = forcedBy.String
+		m.ForcedAt = nullTimeToPtr(forcedAt)
+		m.LastError = lastError.String
+		migrations = append(migrations, m)
+	}
+
+	return migrations, rows.Err()
+}
+
+func (d *MySQLDriver) updateMigration(ctx context.Context, exec Executor, name string, executed Executed) error {
+	q := mysqlUpdateMigrationSql(d.config.Table, executed)
+
+	_, err := exec.ExecContext(ctx, q, executed, time.Now().UTC(), name)
+	if err != nil {
+		return fmt.Errorf("failed to update migration into %s, %w\nquery:\n%s\n", d.config.Table, err, q)
+	}
+
+	return nil
+}
+
+func (d *MySQLDriver) executeMigration(ctx context.Context, exec Executor, name, sql string, executed Executed) error {
+	// go migrations and empty files only update the migrations table
+	if len(strings.TrimSpace(sql)) > 0 {
+		_, err := exec.ExecContext(ctx, sql)
+		if err != nil {
+			return fmt.Errorf("failed to execute migration %s, %w\nquery:\n%s\n", name, err, sql)
+		}
+	}
+
+	err := d.updateMigration(ctx, exec, name, executed)
+	if err != nil {
+		return err
+	}
+
+	if executed.Bool() {
+		return d.SetChecksum(ctx, exec, name, Checksum(sql))
+	}
+
+	return nil
+}
+
+func (d *MySQLDriver) Up(ctx context.Context, exec Executor, name, sql string) error {
+	return d.executeMigration(ctx, exec, name, sql, ExecutedYes)
+}
+
+func (d *MySQLDriver) Down(ctx context.Context, exec Executor, name, sql string) error {
+	return d.executeMigration(ctx, exec, name, sql, ExecutedNo)
+}
+
+func (d *MySQLDriver) Mark(ctx context.Context, exec Executor, name string, executed Executed) error {
+	return d.updateMigration(ctx, exec, name, executed)
+}
+
+func (d *MySQLDriver) Force(ctx context.Context, exec Executor, name string, executed Executed, by string) error {
+	err := d.updateMigration(ctx, exec, name, executed)
+	if err != nil {
+		return err
+	}
+
+	q := mysqlForceMigrationSql(d.config.Table)
+
+	_, err = exec.ExecContext(ctx, q, by, time.Now().UTC(), name)
+	if err != nil {
+		return fmt.Errorf("failed to record who forced migration %s in %s, %w\nquery:\n%s\n", name, d.config.Table, err, q)
+	}
+
+	return nil
+}
+
+func (d *MySQLDriver) MarkDirty(ctx context.Context, exec Executor, name, reason string) error {
+	q := mysqlMarkDirtySql(d.config.Table)
+
+	_, err := exec.ExecContext(ctx, q, reason, name)
+	if err != nil {
+		return fmt.Errorf("failed to mark migration %s as dirty in %s, %w\nquery:\n%s\n", name, d.config.Table, err, q)
+	}
+
+	return nil
+}
+
+func (d *MySQLDriver) AddMigration(ctx context.Context, exec Executor, name string, ts time.Time) error {
+	q := mysqlInsertMigrationSql(d.config.Table)
+
+	_, err := exec.ExecContext(ctx, q, name, ts.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert migration into %s, %w\nquery:\n%s\n", d.config.Table, err, q)
+	}
+
+	return nil
+}
+
+func (d *MySQLDriver) SetChecksum(ctx context.Context, exec Executor, name, checksum string) error {
+	q := mysqlSetChecksumSql(d.config.Table)
+
+	_, err := exec.ExecContext(ctx, q, checksum, name)
+	if err != nil {
+		return fmt.Errorf("failed to set checksum of migration %s in %s, %w\nquery:\n%s\n", name, d.config.Table, err, q)
+	}
+
+	return nil
+}
+
+func (d *MySQLDriver) Lock(ctx context.Context, conn *sql.Conn, timeout time.Duration) error {
+	// negative timeout makes GET_LOCK wait forever
+	seconds := -1
+	if timeout > 0 {
+		seconds = max(int(timeout.Seconds()), 1)
+	}
+
+	var locked sql.NullInt64
+
+	err := conn.QueryRowContext(ctx, mysqlLock, d.config.Table, seconds).Scan(&locked)
+	if err != nil {
+		return lockError(ctx, err)
+	}
+
+	if !locked.Valid {
+		return fmt.Errorf("failed to acquire the migrations lock")
+	}
+
+	if locked.Int64 != 1 {
+		return ErrLockTimeout
+	}
+
+	return nil
+}
+
+func (d *MySQLDriver) Unlock(ctx context.Context, conn *sql.Conn) error {
+	var unlocked sql.NullInt64
+
+	err := conn.QueryRowContext(ctx, mysqlUnlock, d.config.Table).Scan(&unlocked)
+	if err != nil {
+		return fmt.Errorf("failed to release the migrations lock, %w", err)
+	}
+
+	if unlocked.Int64 != 1 {
+		return fmt.Errorf("failed to release the migrations lock, lock is not held")
+	}
+
+	return nil
+}
+
+// TransactionalDDL is false, mysql commits every DDL statement implicitly
+// and a failed migration in a transaction may still be half applied.
+func (d *MySQLDriver) TransactionalDDL() bool {
+	return false
+}
+
+// SetTimeouts sets both metadata and row lock wait timeouts, which are in
+// whole seconds. statement is ignored, max_execution_time limits only SELECT
+// statements and MariaDB doesn't have it, migrations are cancelled by the
+// runner's context instead.
+func (d *MySQLDriver) SetTimeouts(ctx context.Context, conn *sql.Conn, statement, lock time.Duration) (func(ctx context.Context) error, error) {
+	restore := func(ctx context.Context) error {
+		return nil
+	}
+
+	if lock <= 0 {
+		return restore, nil
+	}
+
+	var prevLock, prevRowLock int64
+
+	err := conn.QueryRowContext(ctx, mysqlGetTimeouts).Scan(&prevLock, &prevRowLock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timeouts, %w", err)
+	}
+
+	set := func(ctx context.Context, lock, rowLock int64) error {
+		_, err := conn.ExecContext(ctx, mysqlSetTimeouts, lock, rowLock)
+		if err != nil {
+			return fmt.Errorf("failed to set timeouts, %w", err)
+		}
+
+		return nil
+	}
+
+	seconds := max(int64(lock.Seconds()), 1)
+
+	err = set(ctx, seconds, seconds)
+	if err != nil {
+		return nil, err
+	}
+
+	restore = func(ctx context.Context) error {
+		return set(ctx, prevLock, prevRowLock)
+	}
+
+	return restore, nil
+}
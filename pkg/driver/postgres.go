@@ -3,22 +3,30 @@ package driver
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// quoteTable returns schema qualified name of the migrations table with both
+// identifiers quoted, so names with uppercase letters, dashes or quotes work.
+func quoteTable(schemaname, tablename string) string {
+	return pq.QuoteIdentifier(schemaname) + "." + pq.QuoteIdentifier(tablename)
+}
+
 func createMigrationTableSql(schemaname, tablename string) string {
-	return fmt.Sprintf(createMigrationsTable, schemaname, tablename)
+	return fmt.Sprintf(createMigrationsTable, quoteTable(schemaname, tablename))
 }
 
-func hasMigrationTableSql(schemaname, tablename string) string {
-	return fmt.Sprintf(hasMigrationsTable, schemaname, tablename)
+func addColumnSql(schemaname, tablename string, c column) string {
+	return fmt.Sprintf(addColumn, quoteTable(schemaname, tablename), pq.QuoteIdentifier(c.name), c.definition)
 }
 
 func getMigrationsSql(schemaname, tablename string, executed Executed, direction Direction) string {
-	q := fmt.Sprintf(getMigrations, schemaname, tablename)
+	q := fmt.Sprintf(getMigrations, quoteTable(schemaname, tablename))
 
 	if executed.Bool() {
 		q += "WHERE executed = TRUE"
@@ -38,57 +46,127 @@ func getMigrationsSql(schemaname, tablename string, executed Executed, direction
 }
 
 func insertMigrationSql(schemaname, tablename string) string {
-	return fmt.Sprintf(insertMigration, schemaname, tablename)
+	return fmt.Sprintf(insertMigration, quoteTable(schemaname, tablename))
+}
+
+func markDirtySql(schemaname, tablename string) string {
+	return fmt.Sprintf(markDirty, quoteTable(schemaname, tablename))
+}
+
+func forceMigrationSql(schemaname, tablename string) string {
+	return fmt.Sprintf(forceMigration, quoteTable(schemaname, tablename))
+}
+
+func setChecksumSql(schemaname, tablename string) string {
+	return fmt.Sprintf(setChecksum, quoteTable(schemaname, tablename))
 }
 
-func updateMigrationSql(schemaname, tablename string) string {
-	return fmt.Sprintf(updateMigration, schemaname, tablename)
+func updateMigrationSql(schemaname, tablename string, executed Executed) string {
+	return fmt.Sprintf(updateMigration, quoteTable(schemaname, tablename), updatedAtColumn(executed))
 }
 
 const createMigrationsTable = `
-CREATE TABLE IF NOT EXISTS %s.%s (
+CREATE TABLE IF NOT EXISTS %s (
 	id SERIAL PRIMARY KEY,
 	created_at TIMESTAMP NOT NULL,
-	name VARCHAR(128) NOT NULL,
+	name VARCHAR(128) NOT NULL UNIQUE,
 	executed BOOLEAN NOT NULL,
 	executed_at TIMESTAMP DEFAULT NULL,
 	rolled_back_at TIMESTAMP DEFAULT NULL,
-	CONSTRAINT name_unique UNIQUE (name)
+	checksum VARCHAR(64) DEFAULT NULL,
+	forced_by VARCHAR(255) DEFAULT NULL,
+	forced_at TIMESTAMP DEFAULT NULL,
+	dirty BOOLEAN NOT NULL DEFAULT FALSE,
+	last_error TEXT DEFAULT NULL
 );
 `
 
+// columns added after the first release of createMigrationsTable
+var addedColumns = [...]column{
+	{name: "checksum", definition: "VARCHAR(64) DEFAULT NULL"},
+	{name: "forced_by", definition: "VARCHAR(255) DEFAULT NULL"},
+	{name: "forced_at", definition: "TIMESTAMP DEFAULT NULL"},
+	{name: "dirty", definition: "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{name: "last_error", definition: "TEXT DEFAULT NULL"},
+}
+
+const hasColumn = `
+SELECT EXISTS (
+	SELECT 1
+	FROM information_schema.columns
+	WHERE table_schema = $1 AND table_name = $2 AND column_name = $3
+);
+`
+
+const addColumn = `ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s`
+
 const hasMigrationsTable = `
 SELECT EXISTS (
 	SELECT 1 
 	FROM pg_tables 
-	WHERE schemaname = '%s' AND tablename = '%s'
+	WHERE schemaname = $1 AND tablename = $2
 );
 `
 
 const getMigrations = `
-SELECT id, created_at, name, executed
-FROM %s.%s 
+SELECT id, created_at, name, executed, executed_at, rolled_back_at, checksum, forced_by, forced_at, dirty, last_error
+FROM %s 
 `
 
-const insertMigration = `INSERT INTO %s.%s (name, created_at, executed) VALUES ($1, $2, FALSE)`
+const insertMigration = `INSERT INTO %s (name, created_at, executed) VALUES ($1, $2, FALSE)`
 
 const updateMigration = `
-UPDATE %s.%s SET executed = $2
+UPDATE %s SET executed = $2, %s = $3, dirty = FALSE, last_error = NULL
 WHERE name = $1
 `
 
+const markDirty = `
+UPDATE %s SET dirty = TRUE, last_error = $2
+WHERE name = $1
+`
+
+const forceMigration = `
+UPDATE %s SET forced_by = $2, forced_at = $3
+WHERE name = $1
+`
+
+const setChecksum = `
+UPDATE %s SET checksum = $2
+WHERE name = $1
+`
+
+const tryLock = `SELECT pg_try_advisory_lock($1)`
+
+const unlock = `SELECT pg_advisory_unlock($1)`
+
+// sqlstate of statements cancelled by statement_timeout or the client
+const queryCanceled = "57014"
+
+const getTimeouts = `SELECT current_setting('statement_timeout'), current_setting('lock_timeout')`
+
+const setTimeouts = `SELECT set_config('statement_timeout', $1, FALSE), set_config('lock_timeout', $2, FALSE)`
+
 type PostgresqlDriver struct {
 	config ConnectionConfig
 }
 
+var (
+	_ TimeoutSetter           = (*PostgresqlDriver)(nil)
+	_ StatementTimeoutChecker = (*PostgresqlDriver)(nil)
+)
+
+func init() {
+	Register("postgres", NewPostgresqlDriver)
+}
+
 func NewPostgresqlDriver() Driver {
 	return new(PostgresqlDriver)
 }
 
 func (d *PostgresqlDriver) Conn(config ConnectionConfig) (*sql.DB, error) {
-	d.config = config
+	d.Configure(config)
 
-	db, err := sql.Open("postgres", config.DSN)
+	db, err := openDB("postgres", config.DSN, config.InitSQL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database, %w", err)
 	}
@@ -101,12 +179,47 @@ func (d *PostgresqlDriver) Conn(config ConnectionConfig) (*sql.DB, error) {
 	return db, nil
 }
 
-func (d *PostgresqlDriver) CreateMigrationsTable(ctx context.Context, exec Executor) error {
-	q := createMigrationTableSql(d.config.Schema, d.config.Table)
+func (d *PostgresqlDriver) Configure(config ConnectionConfig) {
+	d.config = config
+}
 
-	_, err := exec.ExecContext(ctx, q)
+func (d *PostgresqlDriver) CreateMigrationsTable(ctx context.Context, exec Executor) error {
+	exists, err := d.HasMigrationTable(ctx, exec)
 	if err != nil {
-		return fmt.Errorf("cannot create migrations table, %w\nquery:\n%s\n,", err, q)
+		return err
+	}
+
+	// CREATE TABLE needs privileges a user that only reads and updates an
+	// existing table may not have
+	if !exists {
+		q := createMigrationTableSql(d.config.Schema, d.config.Table)
+
+		_, err := exec.ExecContext(ctx, q)
+		if err != nil {
+			return fmt.Errorf("cannot create migrations table, %w\nquery:\n%s\n,", err, q)
+		}
+	}
+
+	for _, c := range addedColumns {
+		exists := false
+
+		// ALTER TABLE locks the table even when the column exists, and this
+		// runs before every operation that reads the table
+		err := exec.QueryRowContext(ctx, hasColumn, d.config.Schema, d.config.Table, c.name).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check if %s column exists, %w\nquery:\n%s\n", c.name, err, hasColumn)
+		}
+
+		if exists {
+			continue
+		}
+
+		q := addColumnSql(d.config.Schema, d.config.Table, c)
+
+		_, err = exec.ExecContext(ctx, q)
+		if err != nil {
+			return fmt.Errorf("cannot add %s column to migrations table, %w\nquery:\n%s\n,", c.name, err, q)
+		}
 	}
 
 	return nil
@@ -114,9 +227,9 @@ func (d *PostgresqlDriver) CreateMigrationsTable(ctx context.Context, exec Execu
 
 func (d *PostgresqlDriver) HasMigrationTable(ctx context.Context, exec Executor) (bool, error) {
 	exists := false
-	q := hasMigrationTableSql(d.config.Schema, d.config.Table)
+	q := hasMigrationsTable
 
-	res := exec.QueryRowContext(ctx, q)
+	res := exec.QueryRowContext(ctx, q, d.config.Schema, d.config.Table)
 	err := res.Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("failed to check if %s.%s table exists, %w\nquery:\n%s\n", d.config.Schema, d.config.Table, err, q)
@@ -136,7 +249,7 @@ func (d *PostgresqlDriver) GetMigrations(ctx context.Context, exec Executor, exe
 
 	migrations, err := d.scanMigrations(rows)
 	if err != nil {
-		return nil, fmt.Errorf("failed to scan migrations from %s.%s, %w", d.config.Schema, d.config.Schema, err)
+		return nil, fmt.Errorf("failed to scan migrations from %s.%s, %w", d.config.Schema, d.config.Table, err)
 	}
 
 	return migrations, nil
@@ -149,9 +262,15 @@ func (d *PostgresqlDriver) scanMigrations(rows *sql.Rows) ([]Migration, error) {
 		var (
 			m            Migration
 			executedBool bool
+			executedAt   sql.NullTime
+			rolledBackAt sql.NullTime
+			checksum     sql.NullString
+			forcedBy     sql.NullString
+			forcedAt     sql.NullTime
+			lastError    sql.NullString
 		)
 
-		err := rows.Scan(&m.ID, &m.CreatedAt, &m.Name, &executedBool)
+		err := rows.Scan(&m.ID, &m.CreatedAt, &m.Name, &executedBool, &executedAt, &rolledBackAt, &checksum, &forcedBy, &forcedAt, &m.Dirty, &lastError)
 		if err != nil {
 			return nil, err
 		}
@@ -163,6 +282,12 @@ func (d *PostgresqlDriver) scanMigrations(rows *sql.Rows) ([]Migration, error) {
 		}
 
 		m.CreatedAt = m.CreatedAt.UTC()
+		m.ExecutedAt = nullTimeToPtr(executedAt)
+		m.RolledBackAt = nullTimeToPtr(rolledBackAt)
+		m.Checksum = checksum.String
+		m.ForcedBy = forcedBy.String
+		m.ForcedAt = nullTimeToPtr(forcedAt)
+		m.LastError = lastError.String
 		migrations = append(migrations, m)
 	}
 
@@ -171,9 +296,9 @@ func (d *PostgresqlDriver) scanMigrations(rows *sql.Rows) ([]Migration, error) {
 }
 
 func (d *PostgresqlDriver) updateMigration(ctx context.Context, exec Executor, name string, executed Executed) error {
-	q := updateMigrationSql(d.config.Schema, d.config.Table)
+	q := updateMigrationSql(d.config.Schema, d.config.Table, executed)
 
-	_, err := exec.ExecContext(ctx, q, name, executed)
+	_, err := exec.ExecContext(ctx, q, name, executed, time.Now().UTC())
 	if err != nil {
 		return fmt.Errorf("failed to update migration into %s.%s, %w\nquery:\n%s\n", d.config.Schema, d.config.Table, err, q)
 	}
@@ -182,16 +307,23 @@ func (d *PostgresqlDriver) updateMigration(ctx context.Context, exec Executor, n
 }
 
 func (d *PostgresqlDriver) executeMigration(ctx context.Context, exec Executor, name, sql string, executed Executed) error {
-	_, err := exec.ExecContext(ctx, sql)
-	if err != nil {
-		return fmt.Errorf("failed to execute migration %s, %w\nquery:\n%s\n", name, err, sql)
+	// go migrations and empty files only update the migrations table
+	if len(strings.TrimSpace(sql)) > 0 {
+		_, err := exec.ExecContext(ctx, sql)
+		if err != nil {
+			return fmt.Errorf("failed to execute migration %s, %w\nquery:\n%s\n", name, err, sql)
+		}
 	}
 
-	err = d.updateMigration(ctx, exec, name, executed)
+	err := d.updateMigration(ctx, exec, name, executed)
 	if err != nil {
 		return err
 	}
 
+	if executed.Bool() {
+		return d.SetChecksum(ctx, exec, name, Checksum(sql))
+	}
+
 	return nil
 }
 
@@ -203,6 +335,37 @@ func (d *PostgresqlDriver) Down(ctx context.Context, exec Executor, name, sql st
 	return d.executeMigration(ctx, exec, name, sql, ExecutedNo)
 }
 
+func (d *PostgresqlDriver) Mark(ctx context.Context, exec Executor, name string, executed Executed) error {
+	return d.updateMigration(ctx, exec, name, executed)
+}
+
+func (d *PostgresqlDriver) Force(ctx context.Context, exec Executor, name string, executed Executed, by string) error {
+	err := d.updateMigration(ctx, exec, name, executed)
+	if err != nil {
+		return err
+	}
+
+	q := forceMigrationSql(d.config.Schema, d.config.Table)
+
+	_, err = exec.ExecContext(ctx, q, name, by, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to record who forced migration %s in %s.%s, %w\nquery:\n%s\n", name, d.config.Schema, d.config.Table, err, q)
+	}
+
+	return nil
+}
+
+func (d *PostgresqlDriver) MarkDirty(ctx context.Context, exec Executor, name, reason string) error {
+	q := markDirtySql(d.config.Schema, d.config.Table)
+
+	_, err := exec.ExecContext(ctx, q, name, reason)
+	if err != nil {
+		return fmt.Errorf("failed to mark migration %s as dirty in %s.%s, %w\nquery:\n%s\n", name, d.config.Schema, d.config.Table, err, q)
+	}
+
+	return nil
+}
+
 func (d *PostgresqlDriver) AddMigration(ctx context.Context, exec Executor, name string, ts time.Time) error {
 	q := insertMigrationSql(d.config.Schema, d.config.Table)
 
@@ -213,3 +376,87 @@ func (d *PostgresqlDriver) AddMigration(ctx context.Context, exec Executor, name
 
 	return nil
 }
+
+func (d *PostgresqlDriver) SetChecksum(ctx context.Context, exec Executor, name, checksum string) error {
+	q := setChecksumSql(d.config.Schema, d.config.Table)
+
+	_, err := exec.ExecContext(ctx, q, name, checksum)
+	if err != nil {
+		return fmt.Errorf("failed to set checksum of migration %s in %s.%s, %w\nquery:\n%s\n", name, d.config.Schema, d.config.Table, err, q)
+	}
+
+	return nil
+}
+
+func (d *PostgresqlDriver) Lock(ctx context.Context, conn *sql.Conn, timeout time.Duration) error {
+	id := lockID(d.config.Schema, d.config.Table)
+
+	return pollLock(ctx, timeout, func(ctx context.Context) (bool, error) {
+		locked := false
+		err := conn.QueryRowContext(ctx, tryLock, id).Scan(&locked)
+		return locked, err
+	})
+}
+
+func (d *PostgresqlDriver) Unlock(ctx context.Context, conn *sql.Conn) error {
+	unlocked := false
+
+	err := conn.QueryRowContext(ctx, unlock, lockID(d.config.Schema, d.config.Table)).Scan(&unlocked)
+	if err != nil {
+		return fmt.Errorf("failed to release the migrations lock, %w", err)
+	}
+
+	if !unlocked {
+		return fmt.Errorf("failed to release the migrations lock, lock is not held")
+	}
+
+	return nil
+}
+
+func (d *PostgresqlDriver) SetTimeouts(ctx context.Context, conn *sql.Conn, statement, lock time.Duration) (func(ctx context.Context) error, error) {
+	var prevStatement, prevLock string
+
+	err := conn.QueryRowContext(ctx, getTimeouts).Scan(&prevStatement, &prevLock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get timeouts, %w", err)
+	}
+
+	set := func(ctx context.Context, statement, lock string) error {
+		_, err := conn.ExecContext(ctx, setTimeouts, statement, lock)
+		if err != nil {
+			return fmt.Errorf("failed to set timeouts, %w", err)
+		}
+
+		return nil
+	}
+
+	newStatement, newLock := prevStatement, prevLock
+	if statement > 0 {
+		newStatement = fmt.Sprintf("%dms", statement.Milliseconds())
+	}
+
+	if lock > 0 {
+		newLock = fmt.Sprintf("%dms", lock.Milliseconds())
+	}
+
+	err = set(ctx, newStatement, newLock)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context) error {
+		return set(ctx, prevStatement, prevLock)
+	}, nil
+}
+
+// IsStatementTimeout reports whether err is query_canceled caused by
+// statement_timeout, the same code is used for queries cancelled by the
+// client.
+func (d *PostgresqlDriver) IsStatementTimeout(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	return pqErr.Code == queryCanceled && strings.Contains(pqErr.Message, "statement timeout")
+}
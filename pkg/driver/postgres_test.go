@@ -0,0 +1,109 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TEST_POSTGRES_DSN_ENV points at a throwaway postgres database, tests that
+// need it are skipped when it is not set. The tests create and drop their
+// own schemas.
+const TEST_POSTGRES_DSN_ENV = "GO_MIGRATE_TEST_POSTGRES_DSN"
+
+func TestPostgresOddNames(t *testing.T) {
+	dsn := os.Getenv(TEST_POSTGRES_DSN_ENV)
+	if len(dsn) == 0 {
+		t.Skipf("%s is not set", TEST_POSTGRES_DSN_ENV)
+	}
+
+	tests := []struct {
+		name   string
+		schema string
+		table  string
+	}{
+		{name: "uppercase", schema: "GoMigrate_Upper", table: "Migrations"},
+		{name: "dashes", schema: "go-migrate-dashes", table: "schema-migrations"},
+		{name: "quotes", schema: `go"migrate"quotes`, table: `my"migrations`},
+		{name: "mixed", schema: `Go-Migrate "Mixed"`, table: `Schema-"Migrations"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testPostgresDriver(t, dsn, tt.schema, tt.table)
+		})
+	}
+}
+
+func testPostgresDriver(t *testing.T, dsn, schema, table string) {
+	ctx := context.Background()
+
+	d := NewPostgresqlDriver()
+	db, err := d.Conn(ConnectionConfig{DSN: dsn, Schema: schema, Table: table})
+	if err != nil {
+		t.Fatalf("Conn: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	_, err = db.ExecContext(ctx, "CREATE SCHEMA "+pq.QuoteIdentifier(schema))
+	if err != nil {
+		t.Fatalf("failed to create schema: %s", err)
+	}
+	t.Cleanup(func() {
+		_, err := db.ExecContext(ctx, "DROP SCHEMA "+pq.QuoteIdentifier(schema)+" CASCADE")
+		if err != nil {
+			t.Errorf("failed to drop schema: %s", err)
+		}
+	})
+
+	testDriverMigrations(t, db, d)
+	testPostgresLock(t, db, d)
+}
+
+// testPostgresLock checks that a second connection can't take the lock
+// while the first one holds it.
+func testPostgresLock(t *testing.T, db *sql.DB, d Driver) {
+	ctx := context.Background()
+
+	first, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get a connection: %s", err)
+	}
+	defer first.Close()
+
+	second, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get a connection: %s", err)
+	}
+	defer second.Close()
+
+	err = d.Lock(ctx, first, time.Second)
+	if err != nil {
+		t.Fatalf("Lock: %s", err)
+	}
+
+	err = d.Lock(ctx, second, time.Second)
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("Lock while the lock is held = %v, want %v", err, ErrLockTimeout)
+	}
+
+	err = d.Unlock(ctx, first)
+	if err != nil {
+		t.Fatalf("Unlock: %s", err)
+	}
+
+	err = d.Lock(ctx, second, time.Second)
+	if err != nil {
+		t.Fatalf("Lock after Unlock: %s", err)
+	}
+
+	err = d.Unlock(ctx, second)
+	if err != nil {
+		t.Fatalf("Unlock: %s", err)
+	}
+}
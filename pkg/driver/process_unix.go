@@ -0,0 +1,14 @@
+//go:build unix
+
+package driver
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processRunning reports whether a process with pid exists on this host.
+func processRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,61 @@
+package driver
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory creates a new, not yet connected, driver.
+type Factory func() Driver
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a driver available under the provided name, the same name
+// is used in GO_MIGRATE_DRIVER. It is meant to be called from init
+// functions of packages that implement drivers. If Register is called twice
+// with the same name or if factory is nil, it panics.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("go-migrate: Register driver factory is nil")
+	}
+
+	if _, dup := factories[name]; dup {
+		panic("go-migrate: Register called twice for driver " + name)
+	}
+
+	factories[name] = factory
+}
+
+// Open creates a new driver registered under the provided name.
+func Open(name string) (Driver, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown driver \"%s\" (forgotten import?), registered drivers %v", name, Drivers())
+	}
+
+	return factory(), nil
+}
+
+// Drivers returns a sorted list of the names of the registered drivers.
+func Drivers() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	list := make([]string, 0, len(factories))
+	for name := range factories {
+		list = append(list, name)
+	}
+
+	sort.Strings(list)
+	return list
+}
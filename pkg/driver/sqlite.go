@@ -0,0 +1,570 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteQuoteIdentifier quotes a table or column name, so names with dashes,
+// quotes or keywords like order work.
+func sqliteQuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqliteLockTable returns the name of the lock table of the migrations table.
+func sqliteLockTable(tablename string) string {
+	return tablename + "_lock"
+}
+
+func sqliteCreateMigrationTableSql(tablename string) string {
+	return fmt.Sprintf(sqliteCreateMigrationsTable, sqliteQuoteIdentifier(tablename))
+}
+
+func sqliteGetMigrationsSql(tablename string, executed Executed, direction Direction) string {
+	q := fmt.Sprintf(sqliteGetMigrations, sqliteQuoteIdentifier(tablename))
+
+	if executed.Bool() {
+		q += "WHERE executed = 1"
+	} else {
+		q += "WHERE executed = 0"
+	}
+
+	q += "\n"
+
+	if direction == DirectionDesc {
+		q += "ORDER BY created_at DESC"
+	} else {
+		q += "ORDER BY created_at ASC"
+	}
+
+	return q
+}
+
+func sqliteAddColumnSql(tablename string, c column) string {
+	return fmt.Sprintf(sqliteAddColumn, sqliteQuoteIdentifier(tablename), sqliteQuoteIdentifier(c.name), c.definition)
+}
+
+func sqliteMarkDirtySql(tablename string) string {
+	return fmt.Sprintf(sqliteMarkDirty, sqliteQuoteIdentifier(tablename))
+}
+
+func sqliteForceMigrationSql(tablename string) string {
+	return fmt.Sprintf(sqliteForceMigration, sqliteQuoteIdentifier(tablename))
+}
+
+func sqliteSetChecksumSql(tablename string) string {
+	return fmt.Sprintf(sqliteSetChecksum, sqliteQuoteIdentifier(tablename))
+}
+
+func sqliteCreateLockTableSql(tablename string) string {
+	return fmt.Sprintf(sqliteCreateLockTable, sqliteQuoteIdentifier(sqliteLockTable(tablename)))
+}
+
+func sqliteLockSql(tablename string) string {
+	return fmt.Sprintf(sqliteLock, sqliteQuoteIdentifier(sqliteLockTable(tablename)))
+}
+
+func sqliteLockHolderSql(tablename string) string {
+	return fmt.Sprintf(sqliteLockHolder, sqliteQuoteIdentifier(sqliteLockTable(tablename)))
+}
+
+func sqliteUnlockSql(tablename string) string {
+	return fmt.Sprintf(sqliteUnlock, sqliteQuoteIdentifier(sqliteLockTable(tablename)))
+}
+
+func sqliteSetBusyTimeoutSql(timeout time.Duration) string {
+	return fmt.Sprintf(sqliteSetBusyTimeout, timeout.Milliseconds())
+}
+
+func sqliteInsertMigrationSql(tablename string) string {
+	return fmt.Sprintf(sqliteInsertMigration, sqliteQuoteIdentifier(tablename))
+}
+
+func sqliteUpdateMigrationSql(tablename string, executed Executed) string {
+	return fmt.Sprintf(sqliteUpdateMigration, sqliteQuoteIdentifier(tablename), updatedAtColumn(executed))
+}
+
+const sqliteCreateMigrationsTable = `
+CREATE TABLE IF NOT EXISTS %s (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at TIMESTAMP NOT NULL,
+	name VARCHAR(128) NOT NULL,
+	executed BOOLEAN NOT NULL,
+	executed_at TIMESTAMP DEFAULT NULL,
+	rolled_back_at TIMESTAMP DEFAULT NULL,
+	checksum VARCHAR(64) DEFAULT NULL,
+	forced_by VARCHAR(255) DEFAULT NULL,
+	forced_at TIMESTAMP DEFAULT NULL,
+	dirty BOOLEAN NOT NULL DEFAULT 0,
+	last_error TEXT DEFAULT NULL,
+	CONSTRAINT name_unique UNIQUE (name)
+);
+`
+
+// columns added after the first release of sqliteCreateMigrationsTable
+var sqliteAddedColumns = [...]column{
+	{name: "checksum", definition: "VARCHAR(64) DEFAULT NULL"},
+	{name: "forced_by", definition: "VARCHAR(255) DEFAULT NULL"},
+	{name: "forced_at", definition: "TIMESTAMP DEFAULT NULL"},
+	{name: "dirty", definition: "BOOLEAN NOT NULL DEFAULT 0"},
+	{name: "last_error", definition: "TEXT DEFAULT NULL"},
+}
+
+const sqliteHasColumn = `
+SELECT EXISTS (
+	SELECT 1
+	FROM pragma_table_info(?)
+	WHERE name = ?
+);
+`
+
+const sqliteAddColumn = `ALTER TABLE %s ADD COLUMN %s %s`
+
+const sqliteHasMigrationsTable = `
+SELECT EXISTS (
+	SELECT 1
+	FROM sqlite_master
+	WHERE type = 'table' AND name = ?
+);
+`
+
+const sqliteGetMigrations = `
+SELECT id, created_at, name, executed, executed_at, rolled_back_at, checksum, forced_by, forced_at, dirty, last_error
+FROM %s
+`
+
+const sqliteInsertMigration = `INSERT INTO %s (name, created_at, executed) VALUES (?, ?, 0)`
+
+const sqliteUpdateMigration = `
+UPDATE %s SET executed = ?, %s = ?, dirty = FALSE, last_error = NULL
+WHERE name = ?
+`
+
+const sqliteMarkDirty = `
+UPDATE %s SET dirty = TRUE, last_error = ?
+WHERE name = ?
+`
+
+const sqliteForceMigration = `
+UPDATE %s SET forced_by = ?, forced_at = ?
+WHERE name = ?
+`
+
+const sqliteSetChecksum = `
+UPDATE %s SET checksum = ?
+WHERE name = ?
+`
+
+// sqlite has no advisory locks, the lock is a single row in a separate
+// table named after the migrations table. pid and host of the process that
+// holds the lock are recorded to detect locks left by dead processes
+const sqliteCreateLockTable = `
+CREATE TABLE IF NOT EXISTS %s (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	locked_at TIMESTAMP NOT NULL,
+	pid INTEGER DEFAULT NULL,
+	host VARCHAR(255) DEFAULT NULL
+);
+`
+
+// columns added to lock tables created by older versions
+var sqliteLockAddedColumns = [...]column{
+	{name: "pid", definition: "INTEGER DEFAULT NULL"},
+	{name: "host", definition: "VARCHAR(255) DEFAULT NULL"},
+}
+
+const sqliteLock = `INSERT OR IGNORE INTO %s (id, locked_at, pid, host) VALUES (1, ?, ?, ?)`
+
+const sqliteLockHolder = `SELECT locked_at, pid, host FROM %s WHERE id = 1`
+
+const sqliteUnlock = `DELETE FROM %s WHERE id = 1`
+
+const sqliteGetBusyTimeout = `PRAGMA busy_timeout`
+
+const sqliteSetBusyTimeout = `PRAGMA busy_timeout = %d`
+
+// SQLiteDriver stores migrations in a single table of a sqlite database.
+// DSN is passed to github.com/mattn/go-sqlite3 as is, so both file paths
+// and ":memory:" work. Schema from ConnectionConfig is ignored.
+type SQLiteDriver struct {
+	config ConnectionConfig
+}
+
+var _ TimeoutSetter = (*SQLiteDriver)(nil)
+
+func init() {
+	Register("sqlite3", NewSQLiteDriver)
+}
+
+func NewSQLiteDriver() Driver {
+	return new(SQLiteDriver)
+}
+
+func (d *SQLiteDriver) Conn(config ConnectionConfig) (*sql.DB, error) {
+	d.Configure(config)
+
+	db, err := openDB("sqlite3", config.DSN, config.InitSQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database, %w", err)
+	}
+
+	// every new connection to ":memory:" opens a new empty database and
+	// sqlite allows only one writer anyway, so keep a single connection
+	db.SetMaxOpenConns(1)
+
+	err = db.Ping()
+	if err != nil {
+		return nil, fmt.Errorf("failed to ping database, %w", err)
+	}
+
+	return db, nil
+}
+
+func (d *SQLiteDriver) Configure(config ConnectionConfig) {
+	d.config = config
+}
+
+func (d *SQLiteDriver) CreateMigrationsTable(ctx context.Context, exec Executor) error {
+	exists, err := d.HasMigrationTable(ctx, exec)
+	if err != nil {
+		return err
+	}
+
+	// CREATE TABLE needs privileges a user that only reads and updates an
+	// existing table may not have
+	if !exists {
+		q := sqliteCreateMigrationTableSql(d.config.Table)
+
+		_, err := exec.ExecContext(ctx, q)
+		if err != nil {
+			return fmt.Errorf("cannot create migrations table, %w\nquery:\n%s\n,", err, q)
+		}
+	}
+
+	for _, c := range sqliteAddedColumns {
+		exists := false
+
+		err := exec.QueryRowContext(ctx, sqliteHasColumn, d.config.Table, c.name).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check if %s column exists, %w\nquery:\n%s\n", c.name, err, sqliteHasColumn)
+		}
+
+		if exists {
+			continue
+		}
+
+		q := sqliteAddColumnSql(d.config.Table, c)
+
+		_, err = exec.ExecContext(ctx, q)
+		if err != nil {
+			return fmt.Errorf("cannot add %s column to migrations table, %w\nquery:\n%s\n,", c.name, err, q)
+		}
+	}
+
+	return nil
+}
+
+func (d *SQLiteDriver) HasMigrationTable(ctx context.Context, exec Executor) (bool, error) {
+	exists := false
+
+	res := exec.QueryRowContext(ctx, sqliteHasMigrationsTable, d.config.Table)
+	err := res.Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if %s table exists, %w\nquery:\n%s\n", d.config.Table, err, sqliteHasMigrationsTable)
+	}
+
+	return exists, nil
+}
+
+func (d *SQLiteDriver) GetMigrations(ctx context.Context, exec Executor, executed Executed, direction Direction) ([]Migration, error) {
+	q := sqliteGetMigrationsSql(d.config.Table, executed, direction)
+
+	rows, err := exec.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get migrations from %s, %w\nquery:\n%s\n", d.config.Table, err, q)
+	}
+	defer rows.Close()
+
+	migrations, err := d.scanMigrations(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan migrations from %s, %w", d.config.Table, err)
+	}
+
+	return migrations, nil
+}
+
+func (d *SQLiteDriver) scanMigrations(rows *sql.Rows) ([]Migration, error) {
+	var migrations []Migration = make([]Migration, 0, 16)
+
+	for rows.Next() {
+		var (
+			m            Migration
+			executedBool bool
+			executedAt   sql.NullTime
+			rolledBackAt sql.NullTime
+			checksum     sql.NullString
+			forcedBy     sql.NullString
+			forcedAt     sql.NullTime
+			lastError    sql.NullString
+		)
+
+		err := rows.Scan(&m.ID, &m.CreatedAt, &m.Name, &executedBool, &executedAt, &rolledBackAt, &checksum, &forcedBy, &forcedAt, &m.Dirty, &lastError)
+		if err != nil {
+			return nil, err
+		}
+
+		if executedBool {
+			m.Executed = ExecutedYes
+		} else {
+			m.Executed = ExecutedNo
+		}
+
+		m.CreatedAt = m.CreatedAt.UTC()
+		m.ExecutedAt = nullTimeToPtr(executedAt)
+		m.RolledBackAt = nullTimeToPtr(rolledBackAt)
+		m.Checksum = checksum.String
+		m.ForcedBy = forcedBy.String
+		m.ForcedAt = nullTimeToPtr(forcedAt)
+		m.LastError = lastError.String
+		migrations = append(migrations, m)
+	}
+
+	return migrations, rows.Err()
+}
+
+func (d *SQLiteDriver) updateMigration(ctx context.Context, exec Executor, name string, executed Executed) error {
+	q := sqliteUpdateMigrationSql(d.config.Table, executed)
+
+	_, err := exec.ExecContext(ctx, q, executed, time.Now().UTC(), name)
+	if err != nil {
+		return fmt.Errorf("failed to update migration into %s, %w\nquery:\n%s\n", d.config.Table, err, q)
+	}
+
+	return nil
+}
+
+func (d *SQLiteDriver) executeMigration(ctx context.Context, exec Executor, name, sql string, executed Executed) error {
+	// go migrations and empty files only update the migrations table
+	if len(strings.TrimSpace(sql)) > 0 {
+		_, err := exec.ExecContext(ctx, sql)
+		if err != nil {
+			return fmt.Errorf("failed to execute migration %s, %w\nquery:\n%s\n", name, err, sql)
+		}
+	}
+
+	err := d.updateMigration(ctx, exec, name, executed)
+	if err != nil {
+		return err
+	}
+
+	if executed.Bool() {
+		return d.SetChecksum(ctx, exec, name, Checksum(sql))
+	}
+
+	return nil
+}
+
+func (d *SQLiteDriver) Up(ctx context.Context, exec Executor, name, sql string) error {
+	return d.executeMigration(ctx, exec, name, sql, ExecutedYes)
+}
+
+func (d *SQLiteDriver) Down(ctx context.Context, exec Executor, name, sql string) error {
+	return d.executeMigration(ctx, exec, name, sql, ExecutedNo)
+}
+
+func (d *SQLiteDriver) Mark(ctx context.Context, exec Executor, name string, executed Executed) error {
+	return d.updateMigration(ctx, exec, name, executed)
+}
+
+func (d *SQLiteDriver) Force(ctx context.Context, exec Executor, name string, executed Executed, by string) error {
+	err := d.updateMigration(ctx, exec, name, executed)
+	if err != nil {
+		return err
+	}
+
+	q := sqliteForceMigrationSql(d.config.Table)
+
+	_, err = exec.ExecContext(ctx, q, by, time.Now().UTC(), name)
+	if err != nil {
+		return fmt.Errorf("failed to record who forced migration %s in %s, %w\nquery:\n%s\n", name, d.config.Table, err, q)
+	}
+
+	return nil
+}
+
+func (d *SQLiteDriver) MarkDirty(ctx context.Context, exec Executor, name, reason string) error {
+	q := sqliteMarkDirtySql(d.config.Table)
+
+	_, err := exec.ExecContext(ctx, q, reason, name)
+	if err != nil {
+		return fmt.Errorf("failed to mark migration %s as dirty in %s, %w\nquery:\n%s\n", name, d.config.Table, err, q)
+	}
+
+	return nil
+}
+
+func (d *SQLiteDriver) AddMigration(ctx context.Context, exec Executor, name string, ts time.Time) error {
+	q := sqliteInsertMigrationSql(d.config.Table)
+
+	_, err := exec.ExecContext(ctx, q, name, ts.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert migration into %s, %w\nquery:\n%s\n", d.config.Table, err, q)
+	}
+
+	return nil
+}
+
+func (d *SQLiteDriver) SetChecksum(ctx context.Context, exec Executor, name, checksum string) error {
+	q := sqliteSetChecksumSql(d.config.Table)
+
+	_, err := exec.ExecContext(ctx, q, checksum, name)
+	if err != nil {
+		return fmt.Errorf("failed to set checksum of migration %s in %s, %w\nquery:\n%s\n", name, d.config.Table, err, q)
+	}
+
+	return nil
+}
+
+// Lock inserts the only row of the lock table. If a process dies while
+// holding the lock the row stays there and has to be deleted by hand, Lock
+// returns ErrStaleLock when the process that holds the lock ran on this
+// host and is no longer running.
+func (d *SQLiteDriver) Lock(ctx context.Context, conn *sql.Conn, timeout time.Duration) error {
+	lockTable := sqliteLockTable(d.config.Table)
+	q := sqliteCreateLockTableSql(d.config.Table)
+
+	_, err := conn.ExecContext(ctx, q)
+	if err != nil {
+		return fmt.Errorf("cannot create lock table, %w\nquery:\n%s\n,", err, q)
+	}
+
+	for _, c := range sqliteLockAddedColumns {
+		exists := false
+
+		err := conn.QueryRowContext(ctx, sqliteHasColumn, lockTable, c.name).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check if %s column exists, %w\nquery:\n%s\n", c.name, err, sqliteHasColumn)
+		}
+
+		if exists {
+			continue
+		}
+
+		q := sqliteAddColumnSql(lockTable, c)
+
+		_, err = conn.ExecContext(ctx, q)
+		if err != nil {
+			return fmt.Errorf("cannot add %s column to lock table, %w\nquery:\n%s\n,", c.name, err, q)
+		}
+	}
+
+	pid := os.Getpid()
+	host, _ := os.Hostname()
+	q = sqliteLockSql(d.config.Table)
+
+	return pollLock(ctx, timeout, func(ctx context.Context) (bool, error) {
+		res, err := conn.ExecContext(ctx, q, time.Now().UTC(), pid, host)
+		if err != nil {
+			return false, err
+		}
+
+		inserted, err := res.RowsAffected()
+		if err != nil || inserted == 1 {
+			return inserted == 1, err
+		}
+
+		return false, d.checkLockHolder(ctx, conn, host)
+	})
+}
+
+// checkLockHolder returns ErrStaleLock if the lock is held by a process that
+// ran on host and is no longer running.
+func (d *SQLiteDriver) checkLockHolder(ctx context.Context, conn *sql.Conn, host string) error {
+	var (
+		lockedAt   time.Time
+		holderPid  sql.NullInt64
+		holderHost sql.NullString
+	)
+
+	err := conn.QueryRowContext(ctx, sqliteLockHolderSql(d.config.Table)).Scan(&lockedAt, &holderPid, &holderHost)
+	if errors.Is(err, sql.ErrNoRows) {
+		// released in the meantime
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to check who holds the lock, %w", err)
+	}
+
+	// locks taken by older versions or on other hosts can't be checked
+	if !holderPid.Valid || len(host) == 0 || holderHost.String != host {
+		return nil
+	}
+
+	if processRunning(int(holderPid.Int64)) {
+		return nil
+	}
+
+	return fmt.Errorf("%w, process %d on %s took it at %s, delete it with: %s",
+		ErrStaleLock, holderPid.Int64, holderHost.String, lockedAt.Format(time.DateTime), sqliteUnlockSql(d.config.Table))
+}
+
+func (d *SQLiteDriver) Unlock(ctx context.Context, conn *sql.Conn) error {
+	res, err := conn.ExecContext(ctx, sqliteUnlockSql(d.config.Table))
+	if err != nil {
+		return fmt.Errorf("failed to release the migrations lock, %w", err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to release the migrations lock, %w", err)
+	}
+
+	if deleted != 1 {
+		return fmt.Errorf("failed to release the migrations lock, lock is not held")
+	}
+
+	return nil
+}
+
+// SetTimeouts sets only busy_timeout from lock, sqlite has no statement
+// timeout, statements are interrupted when ctx is done.
+func (d *SQLiteDriver) SetTimeouts(ctx context.Context, conn *sql.Conn, statement, lock time.Duration) (func(ctx context.Context) error, error) {
+	restore := func(ctx context.Context) error {
+		return nil
+	}
+
+	if lock <= 0 {
+		return restore, nil
+	}
+
+	var prevMs int64
+
+	err := conn.QueryRowContext(ctx, sqliteGetBusyTimeout).Scan(&prevMs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get busy timeout, %w", err)
+	}
+
+	_, err = conn.ExecContext(ctx, sqliteSetBusyTimeoutSql(lock))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set busy timeout, %w", err)
+	}
+
+	restore = func(ctx context.Context) error {
+		_, err := conn.ExecContext(ctx, sqliteSetBusyTimeoutSql(time.Duration(prevMs)*time.Millisecond))
+		if err != nil {
+			return fmt.Errorf("failed to set busy timeout, %w", err)
+		}
+
+		return nil
+	}
+
+	return restore, nil
+}
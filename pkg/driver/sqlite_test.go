@@ -0,0 +1,177 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// sqliteFirstMigrationsTable is the migrations table created by the first
+// release of the sqlite driver, before columns were added to it.
+const sqliteFirstMigrationsTable = `
+CREATE TABLE migrations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at TIMESTAMP NOT NULL,
+	name VARCHAR(128) NOT NULL,
+	executed BOOLEAN NOT NULL,
+	executed_at TIMESTAMP DEFAULT NULL,
+	rolled_back_at TIMESTAMP DEFAULT NULL,
+	CONSTRAINT name_unique UNIQUE (name)
+);
+`
+
+func openTestSQLite(t *testing.T, table string) (*sql.DB, Driver) {
+	d := NewSQLiteDriver()
+	db, err := d.Conn(ConnectionConfig{DSN: ":memory:", Table: table})
+	if err != nil {
+		t.Fatalf("Conn: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db, d
+}
+
+func TestSQLiteDriver(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+	}{
+		{name: "plain", table: "migrations"},
+		{name: "dashes", table: "schema-migrations"},
+		{name: "keyword", table: "order"},
+		{name: "quotes", table: `my"migrations`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			db, d := openTestSQLite(t, tt.table)
+
+			testDriverMigrations(t, db, d)
+
+			conn, err := db.Conn(ctx)
+			if err != nil {
+				t.Fatalf("failed to get a connection: %s", err)
+			}
+			defer conn.Close()
+
+			err = d.Lock(ctx, conn, time.Second)
+			if err != nil {
+				t.Fatalf("Lock: %s", err)
+			}
+
+			err = d.Unlock(ctx, conn)
+			if err != nil {
+				t.Fatalf("Unlock: %s", err)
+			}
+		})
+	}
+}
+
+func TestSQLiteUpgradeMigrationsTable(t *testing.T) {
+	ctx := context.Background()
+	db, d := openTestSQLite(t, "migrations")
+
+	_, err := db.ExecContext(ctx, sqliteFirstMigrationsTable)
+	if err != nil {
+		t.Fatalf("failed to create the first release table: %s", err)
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO migrations (created_at, name, executed) VALUES (?, 'old', 1)", time.Unix(1600000000, 0).UTC())
+	if err != nil {
+		t.Fatalf("failed to insert a migration: %s", err)
+	}
+
+	err = d.CreateMigrationsTable(ctx, db)
+	if err != nil {
+		t.Fatalf("CreateMigrationsTable: %s", err)
+	}
+
+	executed, err := d.GetMigrations(ctx, db, ExecutedYes, DirectionAsc)
+	if err != nil {
+		t.Fatalf("GetMigrations: %s", err)
+	}
+	if len(executed) != 1 || executed[0].Name != "old" {
+		t.Fatalf("GetMigrations = %+v, want only old", executed)
+	}
+	if len(executed[0].Checksum) > 0 || executed[0].Dirty {
+		t.Errorf("Checksum, Dirty = %q, %t, want \"\", false", executed[0].Checksum, executed[0].Dirty)
+	}
+}
+
+func TestSQLiteLock(t *testing.T) {
+	ctx := context.Background()
+	db, d := openTestSQLite(t, "migrations")
+
+	// :memory: has a single connection, the lock row is what makes a second
+	// Lock wait, not the connection
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get a connection: %s", err)
+	}
+	defer conn.Close()
+
+	err = d.Lock(ctx, conn, time.Second)
+	if err != nil {
+		t.Fatalf("Lock: %s", err)
+	}
+
+	err = d.Lock(ctx, conn, 100*time.Millisecond)
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("Lock while the lock is held = %v, want %v", err, ErrLockTimeout)
+	}
+
+	err = d.Unlock(ctx, conn)
+	if err != nil {
+		t.Fatalf("Unlock: %s", err)
+	}
+
+	err = d.Unlock(ctx, conn)
+	if err == nil {
+		t.Fatalf("Unlock of a released lock succeeded")
+	}
+
+	err = d.Lock(ctx, conn, time.Second)
+	if err != nil {
+		t.Fatalf("Lock after Unlock: %s", err)
+	}
+
+	// pretend the lock was taken by a process that exited
+	pid := deadPid(t)
+
+	_, err = conn.ExecContext(ctx, "UPDATE migrations_lock SET pid = ?", pid)
+	if err != nil {
+		t.Fatalf("failed to change the lock holder: %s", err)
+	}
+
+	err = d.Lock(ctx, conn, time.Second)
+	if !errors.Is(err, ErrStaleLock) {
+		t.Fatalf("Lock held by a dead process = %v, want %v", err, ErrStaleLock)
+	}
+
+	err = d.Unlock(ctx, conn)
+	if err != nil {
+		t.Fatalf("Unlock of a stale lock: %s", err)
+	}
+}
+
+// deadPid returns the pid of a process that already exited, the test is
+// skipped on platforms where dead processes can't be detected.
+func deadPid(t *testing.T) int {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	err := cmd.Run()
+	if err != nil {
+		t.Fatalf("failed to run a process: %s", err)
+	}
+
+	pid := cmd.Process.Pid
+	if processRunning(pid) {
+		t.Skipf("can't detect that process %d exited on this platform", pid)
+	}
+
+	return pid
+}
@@ -0,0 +1,79 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"github/DusanDjordjic/go-migrate/pkg/driver"
+)
+
+// Baseline marks all migrations up to and including version as executed
+// without executing them. It is used to start using go-migrate on a
+// database that already has the schema those migrations create. Checksums
+// of their up files are recorded, so Verify works for them too.
+func (r *Runner) Baseline(ctx context.Context, version int64) error {
+	if version <= 0 {
+		return fmt.Errorf("baseline version has to be a migration timestamp, but its %d", version)
+	}
+
+	return r.withLock(ctx, func(s session) error {
+		err := r.checkVersion(ctx, s, version)
+		if err != nil {
+			return err
+		}
+
+		return r.baseline(ctx, s, version)
+	})
+}
+
+func (r *Runner) baseline(ctx context.Context, s session, version int64) error {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start a transaction, %w", err)
+	}
+
+	defer tx.Rollback()
+
+	migrations, err := r.loadMigrations(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.CreatedAt.Unix() > version || m.executed() {
+			continue
+		}
+
+		if m.Record == nil {
+			err = r.driver.AddMigration(ctx, tx, m.Name, m.CreatedAt)
+			if err != nil {
+				return fmt.Errorf("failed to register migration %s, %w", m.Name, err)
+			}
+		}
+
+		err = r.driver.Mark(ctx, tx, m.Name, driver.ExecutedYes)
+		if err != nil {
+			return err
+		}
+
+		if len(m.UpFile) > 0 {
+			sql, err := r.readMigrationFile(m.UpFile)
+			if err != nil {
+				return err
+			}
+
+			err = r.driver.SetChecksum(ctx, tx, m.Name, driver.Checksum(sql))
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(r.config.Output, "baseline: marked %s as executed\n", describeMigration(m, m.UpFile))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction, %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"github/DusanDjordjic/go-migrate/pkg/driver"
+	"strings"
+)
+
+// ChecksumMismatch is an applied migration whose up file was changed after
+// the migration was executed.
+type ChecksumMismatch struct {
+	Version  int64
+	Name     string
+	File     string
+	Recorded string
+	Current  string
+}
+
+// ChecksumError is returned by Verify and Up when at least one applied
+// migration file doesn't match its recorded checksum.
+type ChecksumError struct {
+	Mismatches []ChecksumMismatch
+}
+
+func (e *ChecksumError) Error() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%d applied migration(s) changed after they were executed, run repair to accept the changes", len(e.Mismatches))
+	for _, m := range e.Mismatches {
+		fmt.Fprintf(&b, "\n  %s: recorded %s, current %s", m.File, m.Recorded, m.Current)
+	}
+
+	return b.String()
+}
+
+// Verify checks that up files of all applied migrations match the checksums
+// recorded when they were executed. Migrations executed before checksums
+// were recorded and migrations whose file is missing are skipped.
+func (r *Runner) Verify(ctx context.Context) error {
+	err := r.upgradeTable(ctx, r.exec)
+	if err != nil {
+		return err
+	}
+
+	migrations, err := r.loadMigrations(ctx, r.exec)
+	if err != nil {
+		return err
+	}
+
+	return r.verifyChecksums(migrations)
+}
+
+func (r *Runner) verifyChecksums(migrations []*migration) error {
+	var mismatches []ChecksumMismatch
+
+	for _, m := range migrations {
+		if !m.executed() || len(m.Record.Checksum) == 0 || len(m.UpFile) == 0 {
+			continue
+		}
+
+		sql, err := r.readMigrationFile(m.UpFile)
+		if err != nil {
+			return err
+		}
+
+		current := driver.Checksum(sql)
+		if current == m.Record.Checksum {
+			continue
+		}
+
+		mismatches = append(mismatches, ChecksumMismatch{
+			Version:  m.CreatedAt.Unix(),
+			Name:     m.Name,
+			File:     m.UpFile,
+			Recorded: m.Record.Checksum,
+			Current:  current,
+		})
+	}
+
+	if len(mismatches) > 0 {
+		return &ChecksumError{Mismatches: mismatches}
+	}
+
+	return nil
+}
+
+// Repair records current checksums of up files for all applied migrations,
+// accepting changes made to them. It returns the number of updated
+// migrations.
+func (r *Runner) Repair(ctx context.Context) (int, error) {
+	repaired := 0
+
+	err := r.withLock(ctx, func(s session) error {
+		var err error
+		repaired, err = r.repair(ctx, s)
+		return err
+	})
+
+	return repaired, err
+}
+
+func (r *Runner) repair(ctx context.Context, s session) (int, error) {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start a transaction, %w", err)
+	}
+
+	defer tx.Rollback()
+
+	migrations, err := r.loadMigrations(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	repaired := 0
+	for _, m := range migrations {
+		if !m.executed() || len(m.UpFile) == 0 {
+			continue
+		}
+
+		sql, err := r.readMigrationFile(m.UpFile)
+		if err != nil {
+			return 0, err
+		}
+
+		current := driver.Checksum(sql)
+		if current == m.Record.Checksum {
+			continue
+		}
+
+		err = r.driver.SetChecksum(ctx, tx, m.Name, current)
+		if err != nil {
+			return 0, err
+		}
+
+		repaired++
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("failed to commit transaction, %w", err)
+	}
+
+	return repaired, nil
+}
@@ -0,0 +1,40 @@
+package runner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DirtyError is returned by Up, Down and Redo when a migration failed outside of a
+// transaction and the schema may be half migrated. Fix the schema by hand
+// and mark the migration with Force before migrating again.
+type DirtyError struct {
+	Version   int64
+	Name      string
+	LastError string
+}
+
+func (e *DirtyError) Error() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "migration %d_%s is dirty, fix the schema by hand and run force to mark it as applied or pending", e.Version, e.Name)
+	if len(e.LastError) > 0 {
+		fmt.Fprintf(&b, "\nit failed with: %s", e.LastError)
+	}
+
+	return b.String()
+}
+
+func checkDirty(migrations []*migration) error {
+	for _, m := range migrations {
+		if m.Record != nil && m.Record.Dirty {
+			return &DirtyError{
+				Version:   m.CreatedAt.Unix(),
+				Name:      m.Name,
+				LastError: m.Record.LastError,
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package runner
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"github/DusanDjordjic/go-migrate/pkg/driver"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	upSuffix   = ".up.sql"
+	downSuffix = ".down.sql"
+)
+
+// migration is a migration known from the migrations folder, from the
+// migrations table or from both of them.
+type migration struct {
+	Name      string
+	CreatedAt time.Time
+	// file names inside of the migrations folder, empty if the file is missing
+	UpFile   string
+	DownFile string
+	// row from the migrations table, nil if the migration is not registered
+	Record *driver.Migration
+	// set for migrations registered with RegisterGoMigration, they have no
+	// files
+	Go *goMigration
+}
+
+func (m *migration) executed() bool {
+	return m.Record != nil && m.Record.Executed.Bool()
+}
+
+func migrationKey(name string, ts time.Time) string {
+	return strconv.FormatInt(ts.UTC().Unix(), 10) + "_" + name
+}
+
+// parseMigrationFilename parses "<ts>_<name>.up.sql" and
+// "<ts>_<name>.down.sql" file names. ok is false for all other files.
+func parseMigrationFilename(filename string) (name string, ts time.Time, up bool, ok bool) {
+	var base string
+
+	if b, found := strings.CutSuffix(filename, upSuffix); found {
+		base, up = b, true
+	} else if b, found := strings.CutSuffix(filename, downSuffix); found {
+		base, up = b, false
+	} else {
+		return "", time.Time{}, false, false
+	}
+
+	rawTs, name, found := strings.Cut(base, "_")
+	if !found || len(name) == 0 {
+		return "", time.Time{}, false, false
+	}
+
+	unix, err := strconv.ParseInt(rawTs, 10, 64)
+	if err != nil {
+		return "", time.Time{}, false, false
+	}
+
+	return name, time.Unix(unix, 0).UTC(), up, true
+}
+
+// discoverMigrations lists migration files from the migrations source.
+func (r *Runner) discoverMigrations() ([]*migration, error) {
+	entries, err := fs.ReadDir(r.config.FS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read \"%s\" migrations folder, %w", r.config.MigrationsFolder, err)
+	}
+
+	byKey := make(map[string]*migration, len(entries))
+	migrations := make([]*migration, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name, ts, up, ok := parseMigrationFilename(entry.Name())
+		if !ok {
+			continue
+		}
+
+		key := migrationKey(name, ts)
+		m, found := byKey[key]
+		if !found {
+			m = &migration{Name: name, CreatedAt: ts}
+			byKey[key] = m
+			migrations = append(migrations, m)
+		}
+
+		if up {
+			m.UpFile = entry.Name()
+		} else {
+			m.DownFile = entry.Name()
+		}
+	}
+
+	return migrations, nil
+}
+
+// readMigrationFile reads a file from the migrations source.
+func (r *Runner) readMigrationFile(filename string) (string, error) {
+	fullpath := filepath.Join(r.config.MigrationsFolder, filename)
+
+	sql, err := fs.ReadFile(r.config.FS, filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to read migration from file \"%s\", %w", fullpath, err)
+	}
+
+	return bytesToString(sql), nil
+}
+
+// loadMigrations merges migration files with rows from the migrations
+// table. Files are the source of truth, a file that is not registered yet
+// is returned with a nil Record. Result is sorted by time of creation.
+func (r *Runner) loadMigrations(ctx context.Context, exec driver.Executor) ([]*migration, error) {
+	migrations, err := r.discoverMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err = registeredGoMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]*migration, len(migrations))
+	for _, m := range migrations {
+		byKey[migrationKey(m.Name, m.CreatedAt)] = m
+	}
+
+	for _, executed := range [...]driver.Executed{driver.ExecutedYes, driver.ExecutedNo} {
+		records, err := r.driver.GetMigrations(ctx, exec, executed, driver.DirectionAsc)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range records {
+			record := &records[i]
+			key := migrationKey(record.Name, record.CreatedAt)
+
+			m, found := byKey[key]
+			if !found {
+				m = &migration{Name: record.Name, CreatedAt: record.CreatedAt.Truncate(time.Second)}
+				byKey[key] = m
+				migrations = append(migrations, m)
+			}
+
+			m.Record = record
+		}
+	}
+
+	slices.SortFunc(migrations, func(a, b *migration) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.Name, b.Name))
+	})
+
+	return migrations, nil
+}
@@ -0,0 +1,433 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github/DusanDjordjic/go-migrate/pkg/driver"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// NoTransactionDirective is a line that makes the runner execute a migration
+// file outside of a transaction, needed for statements like
+// CREATE INDEX CONCURRENTLY.
+const NoTransactionDirective = "-- go-migrate: no-transaction"
+
+// TxMode decides how migrations are wrapped in transactions. Drivers
+// without transactional DDL, like mysql, commit schema changes implicitly,
+// so a transaction only protects data changes there and a failed migration
+// is always marked dirty.
+type TxMode uint8
+
+const (
+	// all migrations of a single Up or Down run in one transaction, a
+	// migration without a transaction commits the migrations before it
+	TxModeBatch TxMode = iota
+	// every migration runs in its own transaction
+	TxModeMigration
+	// migrations run without a transaction
+	TxModeNone
+)
+
+func (m TxMode) String() string {
+	switch m {
+	case TxModeBatch:
+		return "batch"
+	case TxModeMigration:
+		return "migration"
+	case TxModeNone:
+		return "none"
+	default:
+		return fmt.Sprintf("TxMode(%d)", m)
+	}
+}
+
+// ParseTxMode parses "batch", "migration" and "none".
+func ParseTxMode(s string) (TxMode, error) {
+	for _, m := range [...]TxMode{TxModeBatch, TxModeMigration, TxModeNone} {
+		if s == m.String() {
+			return m, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid transaction mode \"%s\", it can be batch, migration or none", s)
+}
+
+func hasNoTransactionDirective(sql string) bool {
+	scanner := bufio.NewScanner(strings.NewReader(sql))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == NoTransactionDirective {
+			return true
+		}
+	}
+
+	return false
+}
+
+// connExecutor runs queries directly on a connection, outside of a
+// transaction.
+type connExecutor struct {
+	*sql.Conn
+}
+
+var _ driver.Executor = connExecutor{}
+
+func (c connExecutor) Exec(query string, args ...any) (sql.Result, error) {
+	return c.ExecContext(context.Background(), query, args...)
+}
+
+func (c connExecutor) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.QueryContext(context.Background(), query, args...)
+}
+
+func (c connExecutor) QueryRow(query string, args ...any) *sql.Row {
+	return c.QueryRowContext(context.Background(), query, args...)
+}
+
+// beginTx starts a transaction on conn that the caller rolls back when ctx
+// is cancelled. Statements still use ctx, but database/sql rolling back on
+// its own races with the cancelled statement and can leave the session in
+// a transaction on some drivers, with the migrations lock inside of it.
+func beginTx(ctx context.Context, conn *sql.Conn) (*sql.Tx, error) {
+	return conn.BeginTx(context.WithoutCancel(ctx), nil)
+}
+
+// transaction is a transaction migrations run in, started by the runner or
+// owned by the caller of NewWithExecutor.
+type transaction interface {
+	driver.Executor
+	Commit() error
+	Rollback() error
+}
+
+// callerTx is a transaction of the caller of NewWithExecutor, the caller
+// commits or rolls it back.
+type callerTx struct {
+	*sql.Tx
+}
+
+func (tx callerTx) Commit() error {
+	return nil
+}
+
+func (tx callerTx) Rollback() error {
+	return nil
+}
+
+// session is where an operation runs, a single connection or a
+// transaction of the caller of NewWithExecutor.
+type session struct {
+	conn *sql.Conn
+	tx   *sql.Tx
+}
+
+// executor runs queries outside of transactions started by the runner.
+func (s session) executor() driver.Executor {
+	if s.tx != nil {
+		return s.tx
+	}
+
+	return connExecutor{s.conn}
+}
+
+// begin starts a transaction on the connection, in a transaction of the
+// caller everything already runs in one.
+func (s session) begin(ctx context.Context) (transaction, error) {
+	if s.tx != nil {
+		return callerTx{s.tx}, nil
+	}
+
+	tx, err := beginTx(ctx, s.conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// execute runs up or down files of migrations in order, wrapping them in
+// transactions according to the configured TxMode. All files are read
+// before anything is executed. When ctx is cancelled the current
+// transaction is rolled back and the error says how many migrations were
+// applied.
+func (r *Runner) execute(ctx context.Context, s session, migrations []*migration, up bool) (err error) {
+	files := make([]string, len(migrations))
+	sqls := make([]string, len(migrations))
+
+	for i, migration := range migrations {
+		if migration.Go != nil {
+			continue
+		}
+
+		files[i] = migration.DownFile
+		if up {
+			files[i] = migration.UpFile
+		}
+
+		if len(files[i]) == 0 {
+			filename := migrationFilename(migration.Name, migration.CreatedAt, up)
+			return fmt.Errorf("migration %d: migration file \"%s\" is missing", i+1, filename)
+		}
+
+		sql, err := r.readMigrationFile(files[i])
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		sqls[i] = sql
+	}
+
+	if r.config.DryRun {
+		return r.printPlan(migrations, files, sqls)
+	}
+
+	// timeouts are set on a connection, in a transaction of the caller only
+	// the context deadline of Timeout applies
+	if s.conn != nil && (r.config.Timeout > 0 || r.config.LockTimeout > 0) {
+		restore, err := driver.SetTimeouts(ctx, r.driver, s.conn, r.config.Timeout, r.config.LockTimeout)
+		if err != nil {
+			return err
+		}
+
+		defer restore(context.WithoutCancel(ctx))
+	}
+
+	var tx transaction
+
+	// migrations that ran in tx, they are reported as executed and passed
+	// to the after migration hook only once tx commits
+	var uncommitted []MigrationEvent
+
+	// executed reports a migration that is committed or ran without a
+	// transaction
+	executed := func(event MigrationEvent) {
+		r.config.Hooks.after(ctx, event, nil)
+		fmt.Fprintf(r.config.Output, "migration %d of %d: executed %s\n", event.Index, event.Total, describeMigration(migrations[event.Index-1], files[event.Index-1]))
+	}
+
+	// rollback rolls back tx and reports migrations that ran in it
+	rollback := func(cause error) {
+		tx.Rollback()
+		tx = nil
+
+		for _, event := range uncommitted {
+			r.config.Hooks.after(ctx, event, fmt.Errorf("rolled back with its transaction, %w", cause))
+			fmt.Fprintf(r.config.Output, "migration %d of %d: %s was not committed, its transaction was rolled back\n", event.Index, event.Total, describeMigration(migrations[event.Index-1], files[event.Index-1]))
+		}
+
+		uncommitted = nil
+	}
+
+	// number of migrations that are committed or ran without a transaction
+	applied := 0
+
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = fmt.Errorf("cancelled after migration %d of %d, %w", applied, len(migrations), err)
+		}
+	}()
+
+	// runs before the error is wrapped above, migrations are reported as
+	// rolled back because of the error itself
+	defer func() {
+		if tx != nil {
+			rollback(err)
+		}
+	}()
+
+	// commit commits the transaction with migrations up to n
+	commit := func(n int) error {
+		err := tx.Commit()
+		if err != nil {
+			err = fmt.Errorf("failed to commit transaction, %w", err)
+			rollback(err)
+			return err
+		}
+
+		tx = nil
+		for _, event := range uncommitted {
+			executed(event)
+		}
+
+		uncommitted = nil
+		applied = n
+		return nil
+	}
+
+	for i, migration := range migrations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var exec driver.Executor
+
+		if r.config.TxMode == TxModeNone || hasNoTransactionDirective(sqls[i]) {
+			if tx != nil {
+				err := commit(i)
+				if err != nil {
+					return err
+				}
+			}
+
+			exec = s.executor()
+		} else {
+			if tx == nil {
+				var err error
+				tx, err = s.begin(ctx)
+				if err != nil {
+					return fmt.Errorf("failed to start a transaction, %w", err)
+				}
+			}
+
+			exec = tx
+		}
+
+		event := MigrationEvent{
+			Version: migration.CreatedAt.Unix(),
+			Name:    migration.Name,
+			Up:      up,
+			Go:      migration.Go != nil,
+			Index:   i + 1,
+			Total:   len(migrations),
+		}
+
+		err := r.config.Hooks.before(ctx, event)
+		if err != nil {
+			return fmt.Errorf("migration %d: before migration hook failed, %w", i+1, err)
+		}
+
+		err = r.executeMigrationWithTimeout(ctx, exec, migration, sqls[i], up)
+		if err != nil && tx != nil && !driver.TransactionalDDL(r.driver) {
+			// schema changes were committed implicitly, rolling back doesn't
+			// undo the part of the migration that ran
+			rollback(err)
+			exec = s.executor()
+		}
+
+		if err != nil && tx == nil {
+			// without a transaction nothing was rolled back, the schema may be
+			// half migrated
+			dirtyErr := r.driver.MarkDirty(context.WithoutCancel(ctx), exec, migration.Name, err.Error())
+			if dirtyErr != nil {
+				err = errors.Join(err, dirtyErr)
+			}
+		}
+
+		if err != nil {
+			r.config.Hooks.after(ctx, event, err)
+
+			if migration.Go != nil {
+				return fmt.Errorf("migration %d: failed to execute go migration \"%s\", %w", i+1, migration.Name, err)
+			}
+
+			fullpath := filepath.Join(r.config.MigrationsFolder, files[i])
+			return fmt.Errorf("migration %d: failed to execute migration \"%s\", %w", i+1, fullpath, err)
+		}
+
+		if tx == nil {
+			executed(event)
+			applied = i + 1
+			continue
+		}
+
+		uncommitted = append(uncommitted, event)
+
+		if r.config.TxMode == TxModeMigration || i+1 == len(migrations) {
+			err := commit(i + 1)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		fmt.Fprintf(r.config.Output, "migration %d of %d: ran %s, not committed\n", i+1, len(migrations), describeMigration(migration, files[i]))
+	}
+
+	return nil
+}
+
+// executeMigration executes a single migration, go migrations are executed
+// first and then marked in the migrations table by running empty sql.
+func (r *Runner) executeMigration(ctx context.Context, exec driver.Executor, m *migration, sql string, up bool) error {
+	if up && m.Record == nil {
+		err := r.driver.AddMigration(ctx, exec, m.Name, m.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to register migration, %w", err)
+		}
+	}
+
+	if m.Go != nil {
+		err := r.executeGoMigration(ctx, exec, m, up)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !up {
+		return r.driver.Down(ctx, exec, m.Name, sql)
+	}
+
+	return r.driver.Up(ctx, exec, m.Name, sql)
+}
+
+// executeMigrationWithTimeout executes a migration, cancelling it if it runs
+// longer than the configured Timeout.
+func (r *Runner) executeMigrationWithTimeout(ctx context.Context, exec driver.Executor, m *migration, sql string, up bool) error {
+	if r.config.Timeout <= 0 {
+		return r.executeMigration(ctx, exec, m, sql, up)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+
+	// the statement timeout of the session is the same, so the database may
+	// cancel the migration before ctx is done
+	err := r.executeMigration(ctx, exec, m, sql, up)
+	if err != nil && (errors.Is(ctx.Err(), context.DeadlineExceeded) || driver.IsStatementTimeout(r.driver, err)) {
+		return fmt.Errorf("timed out after %s, %w", r.config.Timeout.Round(time.Millisecond), err)
+	}
+
+	return err
+}
+
+// printPlan prints migrations that execute would run, in execution order.
+func (r *Runner) printPlan(migrations []*migration, files, sqls []string) error {
+	w := r.config.Output
+
+	if len(migrations) == 0 {
+		_, err := fmt.Fprintln(w, "-- no migrations to execute")
+		return err
+	}
+
+	for i, migration := range migrations {
+		_, err := fmt.Fprintf(w, "-- migration %d of %d: %s\n", i+1, len(migrations), describeMigration(migration, files[i]))
+		if err == nil && migration.Go == nil {
+			_, err = fmt.Fprintf(w, "%s\n", strings.TrimRight(sqls[i], "\n"))
+		}
+
+		if err == nil {
+			_, err = fmt.Fprintln(w)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to print migrations plan, %w", err)
+		}
+	}
+
+	return nil
+}
+
+// describeMigration returns the file name of a migration or the name of a
+// go migration for progress and plan output.
+func describeMigration(m *migration, file string) string {
+	if m.Go != nil {
+		return "go migration " + migrationKey(m.Name, m.CreatedAt)
+	}
+
+	return file
+}
@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github/DusanDjordjic/go-migrate/pkg/driver"
+)
+
+// newTestRunner creates a runner on an empty in-memory sqlite database with
+// migrations from files.
+func newTestRunner(t *testing.T, files fstest.MapFS, hooks Hooks) (Runner, *bytes.Buffer) {
+	var out bytes.Buffer
+
+	d := driver.NewSQLiteDriver()
+	connConfig := driver.ConnectionConfig{DSN: ":memory:", Table: "migrations"}
+
+	db, err := d.Conn(connConfig)
+	if err != nil {
+		t.Fatalf("Conn: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	r := NewWithDB(d, db, Config{FS: files, Output: &out, Hooks: hooks}, connConfig)
+
+	err = r.Init(context.Background())
+	if err != nil {
+		t.Fatalf("Init: %s", err)
+	}
+
+	return r, &out
+}
+
+func TestExecuteReportsRolledBackMigrations(t *testing.T) {
+	files := fstest.MapFS{
+		"1700000001_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"1700000001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"1700000002_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+		"1700000002_b.down.sql": {Data: []byte("DROP TABLE missing;")},
+		"1700000003_c.up.sql":   {Data: []byte("CREATE TABLE c (id INTEGER);")},
+		"1700000003_c.down.sql": {Data: []byte("DROP TABLE c;")},
+	}
+
+	var succeeded, failed []string
+	hooks := Hooks{
+		AfterMigration: func(ctx context.Context, event MigrationEvent, err error) {
+			if err != nil {
+				failed = append(failed, event.Name)
+			} else {
+				succeeded = append(succeeded, event.Name)
+			}
+		},
+	}
+
+	r, out := newTestRunner(t, files, hooks)
+	ctx := context.Background()
+
+	err := r.Up(ctx, UnlimitedSteps)
+	if err != nil {
+		t.Fatalf("Up: %s", err)
+	}
+
+	// migrations are reported as executed once the batch commits
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) < 3 || strings.Count(strings.Join(lines[len(lines)-3:], "\n"), ": executed ") != 3 {
+		t.Errorf("Up output doesn't end with 3 executed migrations:\n%s", out)
+	}
+
+	out.Reset()
+	succeeded, failed = nil, nil
+
+	// c is rolled back in the batch transaction, then b fails
+	err = r.Down(ctx, UnlimitedSteps)
+	if err == nil {
+		t.Fatalf("Down succeeded with a failing down file")
+	}
+
+	output := out.String()
+	if strings.Contains(output, "executed") {
+		t.Errorf("Down output reports a migration that was rolled back as executed:\n%s", output)
+	}
+
+	if !strings.Contains(output, "1700000003_c.down.sql was not committed") {
+		t.Errorf("Down output doesn't report that c was not committed:\n%s", output)
+	}
+
+	if len(succeeded) > 0 {
+		t.Errorf("after migration hook got no error for %v", succeeded)
+	}
+
+	if strings.Join(failed, ",") != "b,c" {
+		t.Errorf("after migration hook got errors for %v, want [b c]", failed)
+	}
+
+	statuses, err := r.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %s", err)
+	}
+
+	for _, s := range statuses {
+		if !s.Applied {
+			t.Errorf("migration %s is pending after the roll back failed", s.Name)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"github/DusanDjordjic/go-migrate/pkg/driver"
+	"time"
+)
+
+// Force marks migrations with the provided version as executed or pending
+// without executing them, to fix the migrations table after a migration
+// failed halfway. by is recorded as the one who changed the migrations, for
+// example user@host.
+func (r *Runner) Force(ctx context.Context, version int64, executed bool, by string) error {
+	return r.withLock(ctx, func(s session) error {
+		return r.force(ctx, s, version, executed, by)
+	})
+}
+
+func (r *Runner) force(ctx context.Context, s session, version int64, executed bool, by string) error {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start a transaction, %w", err)
+	}
+
+	defer tx.Rollback()
+
+	migrations, err := r.loadMigrations(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	state, flag := "pending", driver.ExecutedNo
+	if executed {
+		state, flag = "applied", driver.ExecutedYes
+	}
+
+	forced := 0
+	for _, m := range migrations {
+		if m.CreatedAt.Unix() != version {
+			continue
+		}
+
+		if m.Record == nil {
+			err = r.driver.AddMigration(ctx, tx, m.Name, m.CreatedAt)
+			if err != nil {
+				return fmt.Errorf("failed to register migration %s, %w", m.Name, err)
+			}
+		}
+
+		err = r.driver.Force(ctx, tx, m.Name, flag, by)
+		if err != nil {
+			return err
+		}
+
+		if executed && len(m.UpFile) > 0 {
+			sql, err := r.readMigrationFile(m.UpFile)
+			if err != nil {
+				return err
+			}
+
+			err = r.driver.SetChecksum(ctx, tx, m.Name, driver.Checksum(sql))
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(r.config.Output, "force: marked %s as %s by %s at %s\n", migrationKey(m.Name, m.CreatedAt), state, by, time.Now().UTC().Format(time.DateTime))
+		forced++
+	}
+
+	if forced == 0 {
+		return fmt.Errorf("there is no migration with version %d", version)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction, %w", err)
+	}
+
+	return nil
+}
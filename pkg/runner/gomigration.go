@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"github/DusanDjordjic/go-migrate/pkg/driver"
+	"sync"
+	"time"
+)
+
+// GoMigrationFunc is the up or down part of a migration written in Go. exec
+// is the transaction or the connection the migration runs on.
+type GoMigrationFunc func(ctx context.Context, exec driver.Executor) error
+
+type goMigration struct {
+	up   GoMigrationFunc
+	down GoMigrationFunc
+}
+
+var (
+	goMigrationsMu sync.RWMutex
+	goMigrations   = make(map[string]goMigration)
+)
+
+// RegisterGoMigration registers a migration written in Go. version is a
+// unix timestamp, the same as the prefix of migration file names, and
+// decides where the migration runs between the migration files. Go
+// migrations are tracked in the migrations table like migration files.
+// down can be nil if the migration can't be rolled back. It is meant to be
+// called from init functions, it panics if up is nil or if the same
+// migration is registered twice.
+func RegisterGoMigration(version int64, name string, up, down GoMigrationFunc) {
+	goMigrationsMu.Lock()
+	defer goMigrationsMu.Unlock()
+
+	if up == nil {
+		panic("go-migrate: RegisterGoMigration up function is nil")
+	}
+
+	key := migrationKey(name, time.Unix(version, 0))
+	if _, dup := goMigrations[key]; dup {
+		panic("go-migrate: RegisterGoMigration called twice for migration " + key)
+	}
+
+	goMigrations[key] = goMigration{up: up, down: down}
+}
+
+// registeredGoMigrations adds registered Go migrations to migrations
+// discovered in the migrations folder.
+func registeredGoMigrations(migrations []*migration) ([]*migration, error) {
+	goMigrationsMu.RLock()
+	defer goMigrationsMu.RUnlock()
+
+	byKey := make(map[string]*migration, len(migrations))
+	for _, m := range migrations {
+		byKey[migrationKey(m.Name, m.CreatedAt)] = m
+	}
+
+	for key, g := range goMigrations {
+		if _, found := byKey[key]; found {
+			return nil, fmt.Errorf("go migration %s has the same version and name as migration files", key)
+		}
+
+		name, ts, _, _ := parseMigrationFilename(key + upSuffix)
+		migrations = append(migrations, &migration{
+			Name:      name,
+			CreatedAt: ts,
+			Go:        &g,
+		})
+	}
+
+	return migrations, nil
+}
+
+func (r *Runner) executeGoMigration(ctx context.Context, exec driver.Executor, m *migration, up bool) error {
+	fn := m.Go.down
+	if up {
+		fn = m.Go.up
+	}
+
+	if fn == nil {
+		return fmt.Errorf("go migration %s can't be rolled back, it has no down function", m.Name)
+	}
+
+	return fn(ctx, exec)
+}
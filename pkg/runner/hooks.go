@@ -0,0 +1,46 @@
+package runner
+
+import (
+	"context"
+)
+
+// MigrationEvent describes a migration passed to hooks.
+type MigrationEvent struct {
+	// unix timestamp from the migration file name
+	Version int64
+	Name    string
+	// true when the migration is executed, false when it is rolled back
+	Up bool
+	// registered with RegisterGoMigration
+	Go bool
+	// position of the migration in the run, starting from 1
+	Index int
+	// number of migrations in the run
+	Total int
+}
+
+// Hooks are called around every migration that Up, Down and other
+// operations execute, they are not called in dry runs.
+type Hooks struct {
+	// called before a migration is executed, an error stops the run before
+	// the migration
+	BeforeMigration func(ctx context.Context, event MigrationEvent) error
+	// called after a migration failed, or once it is committed with err set
+	// to nil. A migration that ran in a transaction that was rolled back
+	// because a later migration failed is passed with an error too
+	AfterMigration func(ctx context.Context, event MigrationEvent, err error)
+}
+
+func (h Hooks) before(ctx context.Context, event MigrationEvent) error {
+	if h.BeforeMigration == nil {
+		return nil
+	}
+
+	return h.BeforeMigration(ctx, event)
+}
+
+func (h Hooks) after(ctx context.Context, event MigrationEvent, err error) {
+	if h.AfterMigration != nil {
+		h.AfterMigration(ctx, event, err)
+	}
+}
@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+)
+
+// Redo rolls back the last n executed migrations and executes them again,
+// while holding the migrations lock the whole time. Migration files are
+// read again before they are executed, so changes made to them are picked
+// up.
+func (r *Runner) Redo(ctx context.Context, n int) error {
+	if n <= 0 {
+		return fmt.Errorf("number of migrations to redo has to be positive, but its %d", n)
+	}
+
+	return r.withLock(ctx, func(s session) error {
+		return r.redo(ctx, s, n)
+	})
+}
+
+func (r *Runner) redo(ctx context.Context, s session, n int) error {
+	all, err := r.loadMigrations(ctx, s.executor())
+	if err != nil {
+		return err
+	}
+
+	err = checkDirty(all)
+	if err != nil {
+		return err
+	}
+
+	rollback := make([]*migration, 0, n)
+	for i := len(all) - 1; i >= 0 && len(rollback) < n; i-- {
+		if all[i].executed() {
+			rollback = append(rollback, all[i])
+		}
+	}
+
+	if len(rollback) == 0 {
+		fmt.Fprintln(r.config.Output, "redo: there are no executed migrations")
+		return nil
+	}
+
+	fmt.Fprintf(r.config.Output, "redo: rolling back %d migration(s)\n", len(rollback))
+
+	err = r.execute(ctx, s, rollback, down)
+	if err != nil {
+		return fmt.Errorf("redo: failed to roll back, %w", err)
+	}
+
+	keys := make(map[string]bool, len(rollback))
+	for _, m := range rollback {
+		keys[migrationKey(m.Name, m.CreatedAt)] = true
+	}
+
+	// load again so the up files are read after the roll back
+	all, err = r.loadMigrations(ctx, s.executor())
+	if err != nil {
+		return err
+	}
+
+	reapply := make([]*migration, 0, len(rollback))
+	for _, m := range all {
+		if keys[migrationKey(m.Name, m.CreatedAt)] {
+			reapply = append(reapply, m)
+		}
+	}
+
+	fmt.Fprintf(r.config.Output, "redo: executing %d migration(s)\n", len(reapply))
+
+	err = r.execute(ctx, s, reapply, up)
+	if err != nil {
+		return fmt.Errorf("redo: failed to execute again, %w", err)
+	}
+
+	return nil
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"github/DusanDjordjic/go-migrate/pkg/driver"
 	"io"
+	"io/fs"
+	"math"
 	"os"
 	"path/filepath"
 	"time"
@@ -19,14 +21,44 @@ const (
 	down           = false
 )
 
+// ErrNoDB is returned by operations that execute migrations when the runner
+// was created with NewWithExecutor and an executor that is not a *sql.DB or
+// a *sql.Tx.
+var ErrNoDB = errors.New("runner needs a *sql.DB, *sql.Conn or *sql.Tx to execute migrations, only Init, Status and Verify can run on other executors")
+
 type Runner struct {
 	driver driver.Driver
-	db     *sql.DB
+	// database, connection or transaction all operations run on
+	exec   driver.Executor
 	config Config
 }
 
 type Config struct {
+	// folder where Init and New create migration files
 	MigrationsFolder string
+	// source of migrations read by all other operations, for example an
+	// embed.FS. Migration files have to be in its root, use fs.Sub for
+	// embedded folders. Defaults to os.DirFS(MigrationsFolder)
+	FS fs.FS
+	// how long Up and Down wait for other processes to finish migrating,
+	// 0 means wait forever
+	LockWaitTimeout time.Duration
+	// how migrations are wrapped in transactions, TxModeBatch by default.
+	// Migrations with the NoTransactionDirective never run in a transaction
+	TxMode TxMode
+	// how long a single migration can run, 0 means no limit. Postgres also
+	// sets it as the statement timeout of the database session
+	Timeout time.Duration
+	// how long statements of migrations wait for locks held by other
+	// sessions, 0 keeps the database default
+	LockTimeout time.Duration
+	// Up and Down only print migrations they would execute to Output
+	DryRun bool
+	// where executed migrations and dry run plans are printed, defaults to
+	// os.Stdout. Use io.Discard to silence the runner
+	Output io.Writer
+	// called around every executed migration
+	Hooks Hooks
 }
 
 func New(driver driver.Driver, config Config, connConfig driver.ConnectionConfig) (Runner, error) {
@@ -35,15 +67,57 @@ func New(driver driver.Driver, config Config, connConfig driver.ConnectionConfig
 		return Runner{}, err
 	}
 
+	return NewWithDB(driver, db, config, connConfig), nil
+}
+
+// NewWithDB creates a runner that uses db opened by the caller instead of
+// opening a new one. DSN and InitSQL of connConfig are ignored.
+func NewWithDB(driver driver.Driver, db *sql.DB, config Config, connConfig driver.ConnectionConfig) Runner {
+	return NewWithExecutor(driver, db, config, connConfig)
+}
+
+// NewWithConn creates a runner that uses conn opened by the caller, the
+// migrations lock is held on it while migrations run. The caller closes
+// conn, it must not be in a transaction.
+func NewWithConn(driver driver.Driver, conn *sql.Conn, config Config, connConfig driver.ConnectionConfig) Runner {
+	return NewWithExecutor(driver, connExecutor{conn}, config, connConfig)
+}
+
+// NewWithExecutor creates a runner that runs queries on exec, for example
+// a transaction of the caller. On a *sql.Tx migrations run in the
+// transaction without the migrations lock and without transactions of
+// their own, the caller commits or rolls it back and makes sure no other
+// process migrates at the same time. Timeout limits migrations only
+// through the context and LockTimeout is ignored. A *sql.DB works like
+// NewWithDB. Other executors support only Init, Status and Verify,
+// operations that execute migrations return ErrNoDB.
+func NewWithExecutor(driver driver.Driver, exec driver.Executor, config Config, connConfig driver.ConnectionConfig) Runner {
+	driver.Configure(connConfig)
+
+	if config.FS == nil {
+		config.FS = os.DirFS(config.MigrationsFolder)
+	}
+
+	if config.Output == nil {
+		config.Output = os.Stdout
+	}
+
 	return Runner{
 		driver: driver,
-		db:     db,
+		exec:   exec,
 		config: config,
-	}, nil
+	}
 }
 
 func (r *Runner) Init(ctx context.Context) error {
-	_, err := os.Stat(r.config.MigrationsFolder)
+	var err error
+
+	// migrations come only from FS, there is no folder to create
+	if len(r.config.MigrationsFolder) == 0 {
+		goto InitTable
+	}
+
+	_, err = os.Stat(r.config.MigrationsFolder)
 	if err == nil {
 		goto InitTable
 	}
@@ -58,22 +132,21 @@ func (r *Runner) Init(ctx context.Context) error {
 	}
 
 InitTable:
-	exists, err := r.driver.HasMigrationTable(ctx, r.db)
-	if err != nil {
-		return fmt.Errorf("failed to check if migrations table exists, %w", err)
-	}
-
-	if exists {
-		return nil
-	}
-
-	return r.driver.CreateMigrationsTable(ctx, r.db)
+	// CreateMigrationsTable is called for existing tables too, so columns
+	// added in newer versions are added to them
+	return r.driver.CreateMigrationsTable(ctx, r.exec)
 }
 
 func (r *Runner) New(ctx context.Context, name string) ([2]string, error) {
 	timestamp := time.Now().UTC()
 	out := [2]string{}
 
+	// migrations are read only from FS, a file created in the working
+	// directory would never be found
+	if len(r.config.MigrationsFolder) == 0 {
+		return out, errors.New("there is no migrations folder to create migration files in")
+	}
+
 	upfile, err := createMigrationFile(r.config.MigrationsFolder, name, timestamp, true)
 	if err != nil {
 		return out, err
@@ -91,110 +164,184 @@ func (r *Runner) New(ctx context.Context, name string) ([2]string, error) {
 	out[0] = upfile
 	out[1] = downfile
 
-	r.driver.AddMigration(ctx, r.db, name, timestamp)
+	// migration is registered in the migrations table by Up, once the file
+	// is there, so migrations created on other machines are picked up too
 	return out, nil
 }
 
 func (r *Runner) Up(ctx context.Context, steps int) error {
-	tx, err := r.db.Begin()
+	return r.withLock(ctx, func(s session) error {
+		return r.up(ctx, s, steps, math.MaxInt64)
+	})
+}
+
+// up executes pending migrations with versions up to and including
+// maxVersion.
+func (r *Runner) up(ctx context.Context, s session, steps int, maxVersion int64) error {
+	all, err := r.loadMigrations(ctx, s.executor())
 	if err != nil {
-		return fmt.Errorf("failed to start a transaction, %w", err)
+		return err
 	}
 
-	defer tx.Rollback()
+	err = checkDirty(all)
+	if err != nil {
+		return err
+	}
 
-	migrations, err := r.driver.GetMigrations(ctx, tx, driver.ExecutedNo, driver.DirectionAsc)
+	err = r.verifyChecksums(all)
 	if err != nil {
 		return err
 	}
 
+	migrations := r.pendingMigrations(all, maxVersion)
+
 	// limit steps to number of migrations
 	if steps == UnlimitedSteps || steps > len(migrations) {
 		steps = len(migrations)
 	}
 
-	for i := range steps {
-		migration := migrations[i]
-
-		filename := migrationFilename(migration.Name, migration.CreatedAt, up)
-		fullpath := filepath.Join(r.config.MigrationsFolder, filename)
-
-		f, err := os.Open(fullpath)
-		if err != nil {
-			return fmt.Errorf("migration %d: failed to open \"%s\" migration file, %w", i+1, fullpath, err)
-		}
-
-		sql, err := io.ReadAll(f)
-
-		f.Close()
-
-		if err != nil {
-			return fmt.Errorf("migration %d: failed to read migration from file \"%s\", %w", i+1, fullpath, err)
-		}
-
-		err = r.driver.Up(ctx, tx, migration.Name, bytesToString(sql))
-		if err != nil {
-			return fmt.Errorf("migration %d: failed to execute migration \"%s\", %w", i+1, fullpath, err)
-		}
-	}
-
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("failed to commit transaction, %w", err)
-	}
-
-	return nil
+	return r.execute(ctx, s, migrations[:steps], up)
 }
 
 func (r *Runner) Down(ctx context.Context, steps int) error {
-	tx, err := r.db.Begin()
+	return r.withLock(ctx, func(s session) error {
+		return r.down(ctx, s, steps, math.MinInt64)
+	})
+}
+
+// down rolls back executed migrations with versions after minVersion.
+func (r *Runner) down(ctx context.Context, s session, steps int, minVersion int64) error {
+	all, err := r.loadMigrations(ctx, s.executor())
 	if err != nil {
-		return fmt.Errorf("failed to start a transaction, %w", err)
+		return err
 	}
 
-	defer tx.Rollback()
-
-	migrations, err := r.driver.GetMigrations(ctx, tx, driver.ExecutedYes, driver.DirectionDesc)
+	err = checkDirty(all)
 	if err != nil {
 		return err
 	}
 
+	migrations := executedMigrations(all, minVersion)
+
 	// limit steps to number of migrations
 	if steps == UnlimitedSteps || steps > len(migrations) {
 		steps = len(migrations)
 	}
 
-	for i := range steps {
-		migration := migrations[i]
+	return r.execute(ctx, s, migrations[:steps], down)
+}
 
-		filename := migrationFilename(migration.Name, migration.CreatedAt, down)
-		fullpath := filepath.Join(r.config.MigrationsFolder, filename)
+// pendingMigrations returns pending migrations with versions up to and
+// including maxVersion, in execution order.
+func (r *Runner) pendingMigrations(all []*migration, maxVersion int64) []*migration {
+	migrations := make([]*migration, 0, len(all))
+	for _, m := range all {
+		if m.executed() || m.CreatedAt.Unix() > maxVersion {
+			continue
+		}
 
-		f, err := os.Open(fullpath)
-		if err != nil {
-			return fmt.Errorf("migration %d: failed to open \"%s\" migration file, %w", i+1, fullpath, err)
+		// files are the source of truth, a row whose file never arrived
+		// doesn't block other migrations, status reports it
+		if m.Go == nil && len(m.UpFile) == 0 {
+			fmt.Fprintf(r.config.Output, "warning: skipping pending migration %s, its up file is missing\n", migrationFilename(m.Name, m.CreatedAt, up))
+			continue
+		}
+
+		migrations = append(migrations, m)
+	}
+
+	return migrations
+}
+
+// executedMigrations returns executed migrations with versions after
+// minVersion, in roll back order.
+func executedMigrations(all []*migration, minVersion int64) []*migration {
+	migrations := make([]*migration, 0, len(all))
+	for i := len(all) - 1; i >= 0; i-- {
+		if all[i].executed() && all[i].CreatedAt.Unix() > minVersion {
+			migrations = append(migrations, all[i])
 		}
+	}
 
-		sql, err := io.ReadAll(f)
+	return migrations
+}
 
-		f.Close()
+// withLock runs fn on a single connection while holding the migrations lock,
+// so only one process runs migrations at a time. Processes that waited for
+// the lock see migrations executed by the process that held it. A runner
+// created with a transaction runs fn in it without the lock.
+func (r *Runner) withLock(ctx context.Context, fn func(s session) error) error {
+	var conn *sql.Conn
+
+	switch exec := r.exec.(type) {
+	case *sql.DB:
+		var err error
+		conn, err = exec.Conn(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get a database connection, %w", err)
+		}
 
+		defer conn.Close()
+	case connExecutor:
+		// connection of the caller, it stays open
+		conn = exec.Conn
+	case *sql.Tx:
+		// the lock is held by a session and a transaction can't release it,
+		// the caller makes sure nobody else migrates and commits the
+		// transaction
+		s := session{tx: exec}
+
+		err := r.upgradeTable(ctx, s.executor())
 		if err != nil {
-			return fmt.Errorf("migration %d: failed to read migration from file \"%s\", %w", i+1, fullpath, err)
+			return err
 		}
 
-		err = r.driver.Down(ctx, tx, migration.Name, bytesToString(sql))
+		return fn(s)
+	default:
+		return ErrNoDB
+	}
+
+	s := session{conn: conn}
+
+	// dry runs don't change anything, other processes don't have to wait
+	if r.config.DryRun {
+		err := r.upgradeTable(ctx, s.executor())
 		if err != nil {
-			return fmt.Errorf("migration %d: failed to execute migration \"%s\", %w", i+1, fullpath, err)
+			return err
 		}
+
+		return fn(s)
 	}
 
-	err = tx.Commit()
+	err := r.driver.Lock(ctx, conn, r.config.LockWaitTimeout)
 	if err != nil {
-		return fmt.Errorf("failed to commit transaction, %w", err)
+		return err
+	}
+
+	err = r.upgradeTable(ctx, s.executor())
+	if err == nil {
+		err = fn(s)
+	}
+
+	// the lock has to be released even when ctx is cancelled
+	unlockErr := r.driver.Unlock(context.WithoutCancel(ctx), conn)
+	if unlockErr != nil {
+		return errors.Join(err, unlockErr)
+	}
+
+	return err
+}
+
+// upgradeTable adds columns that are missing from a migrations table created
+// by an older version, so it can be read without running Init again. A
+// missing table is left for Init to create.
+func (r *Runner) upgradeTable(ctx context.Context, exec driver.Executor) error {
+	exists, err := r.driver.HasMigrationTable(ctx, exec)
+	if err != nil || !exists {
+		return err
 	}
 
-	return nil
+	return r.driver.CreateMigrationsTable(ctx, exec)
 }
 
 func migrationFilename(name string, ts time.Time, up bool) string {
@@ -0,0 +1,142 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github/DusanDjordjic/go-migrate/pkg/driver"
+)
+
+var testMigrations = fstest.MapFS{
+	"1700000001_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER);")},
+	"1700000001_a.down.sql": {Data: []byte("DROP TABLE a;")},
+	"1700000002_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER);")},
+	"1700000002_b.down.sql": {Data: []byte("DROP TABLE b;")},
+}
+
+// countApplied returns the number of applied migrations seen by r.
+func countApplied(t *testing.T, r Runner) int {
+	t.Helper()
+
+	statuses, err := r.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %s", err)
+	}
+
+	applied := 0
+	for _, s := range statuses {
+		if s.Applied {
+			applied++
+		}
+	}
+
+	return applied
+}
+
+func TestNewWithExecutorTx(t *testing.T) {
+	ctx := context.Background()
+	d := driver.NewSQLiteDriver()
+	connConfig := driver.ConnectionConfig{DSN: ":memory:", Table: "migrations"}
+	config := Config{FS: testMigrations, Output: io.Discard}
+
+	db, err := d.Conn(connConfig)
+	if err != nil {
+		t.Fatalf("Conn: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, commit := range []bool{false, true} {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatalf("BeginTx: %s", err)
+		}
+
+		r := NewWithExecutor(d, tx, config, connConfig)
+
+		err = r.Init(ctx)
+		if err != nil {
+			t.Fatalf("Init: %s", err)
+		}
+
+		err = r.Up(ctx, UnlimitedSteps)
+		if err != nil {
+			t.Fatalf("Up in a transaction: %s", err)
+		}
+
+		if got := countApplied(t, r); got != 2 {
+			t.Fatalf("applied migrations in the transaction = %d, want 2", got)
+		}
+
+		if !commit {
+			// migrations are rolled back with the caller's transaction
+			tx.Rollback()
+
+			exists, err := d.HasMigrationTable(ctx, db)
+			if err != nil {
+				t.Fatalf("HasMigrationTable: %s", err)
+			}
+			if exists {
+				t.Fatalf("migrations table exists after the transaction was rolled back")
+			}
+
+			continue
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			t.Fatalf("Commit: %s", err)
+		}
+
+		if got := countApplied(t, NewWithDB(d, db, config, connConfig)); got != 2 {
+			t.Fatalf("applied migrations after commit = %d, want 2", got)
+		}
+	}
+}
+
+func TestNewWithConn(t *testing.T) {
+	ctx := context.Background()
+	d := driver.NewSQLiteDriver()
+	connConfig := driver.ConnectionConfig{DSN: ":memory:", Table: "migrations"}
+
+	db, err := d.Conn(connConfig)
+	if err != nil {
+		t.Fatalf("Conn: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get a connection: %s", err)
+	}
+	defer conn.Close()
+
+	r := NewWithConn(d, conn, Config{FS: testMigrations, Output: io.Discard}, connConfig)
+
+	err = r.Init(ctx)
+	if err != nil {
+		t.Fatalf("Init: %s", err)
+	}
+
+	err = r.Up(ctx, UnlimitedSteps)
+	if err != nil {
+		t.Fatalf("Up: %s", err)
+	}
+
+	err = r.Down(ctx, 1)
+	if err != nil {
+		t.Fatalf("Down: %s", err)
+	}
+
+	if got := countApplied(t, r); got != 1 {
+		t.Fatalf("applied migrations = %d, want 1", got)
+	}
+
+	// the lock is released, the connection can take it again
+	err = d.Lock(ctx, conn, time.Second)
+	if err != nil {
+		t.Fatalf("Lock after Down: %s", err)
+	}
+}
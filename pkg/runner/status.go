@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"context"
+	"time"
+)
+
+// MigrationStatus describes the state of a single migration, merged from the
+// migrations table and the migrations folder.
+type MigrationStatus struct {
+	// unix timestamp from the migration file name
+	Version      int64      `json:"version"`
+	Name         string     `json:"name"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Applied      bool       `json:"applied"`
+	ExecutedAt   *time.Time `json:"executed_at"`
+	RolledBackAt *time.Time `json:"rolled_back_at"`
+	// who and when last forced the state of the migration
+	ForcedBy string     `json:"forced_by,omitempty"`
+	ForcedAt *time.Time `json:"forced_at,omitempty"`
+	// migration failed outside of a transaction, LastError says why
+	Dirty     bool   `json:"dirty"`
+	LastError string `json:"last_error,omitempty"`
+	// registered with RegisterGoMigration
+	Go bool `json:"go"`
+	// up or down file is not in the migrations folder
+	FileMissing bool `json:"file_missing"`
+	// migration file exists but it is not in the migrations table yet
+	NotRegistered bool `json:"not_registered"`
+}
+
+// Status returns all known migrations sorted by time of creation.
+func (r *Runner) Status(ctx context.Context) ([]MigrationStatus, error) {
+	err := r.upgradeTable(ctx, r.exec)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := r.loadMigrations(ctx, r.exec)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{
+			Version:       m.CreatedAt.Unix(),
+			Name:          m.Name,
+			CreatedAt:     m.CreatedAt,
+			Applied:       m.executed(),
+			FileMissing:   m.Go == nil && (len(m.UpFile) == 0 || len(m.DownFile) == 0),
+			Go:            m.Go != nil,
+			NotRegistered: m.Record == nil,
+		}
+
+		if m.Record != nil {
+			status.ExecutedAt = m.Record.ExecutedAt
+			status.RolledBackAt = m.Record.RolledBackAt
+			status.ForcedBy = m.Record.ForcedBy
+			status.ForcedAt = m.Record.ForcedAt
+			status.Dirty = m.Record.Dirty
+			status.LastError = m.Record.LastError
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
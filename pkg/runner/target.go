@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+)
+
+// UpTo executes all pending migrations with versions up to and including
+// version. version is a unix timestamp from migration file names.
+func (r *Runner) UpTo(ctx context.Context, version int64) error {
+	return r.withLock(ctx, func(s session) error {
+		err := r.checkVersion(ctx, s, version)
+		if err != nil {
+			return err
+		}
+
+		return r.up(ctx, s, UnlimitedSteps, version)
+	})
+}
+
+// DownTo rolls back all executed migrations with versions after version.
+// version 0 rolls back all migrations.
+func (r *Runner) DownTo(ctx context.Context, version int64) error {
+	return r.withLock(ctx, func(s session) error {
+		err := r.checkVersion(ctx, s, version)
+		if err != nil {
+			return err
+		}
+
+		return r.down(ctx, s, UnlimitedSteps, version)
+	})
+}
+
+// MigrateTo brings the database to the state right after the migration with
+// the provided version. Executed migrations after version are rolled back
+// and pending migrations up to and including version are executed.
+// version 0 rolls back all migrations. Dirty migrations and changed files
+// are reported before anything is rolled back.
+func (r *Runner) MigrateTo(ctx context.Context, version int64) error {
+	return r.withLock(ctx, func(s session) error {
+		return r.migrateTo(ctx, s, version)
+	})
+}
+
+func (r *Runner) migrateTo(ctx context.Context, s session, version int64) error {
+	all, err := r.loadMigrations(ctx, s.executor())
+	if err != nil {
+		return err
+	}
+
+	err = hasVersion(all, version)
+	if err != nil {
+		return err
+	}
+
+	err = checkDirty(all)
+	if err != nil {
+		return err
+	}
+
+	err = r.verifyChecksums(all)
+	if err != nil {
+		return err
+	}
+
+	// rolling back migrations after version doesn't change which migrations
+	// up to version are pending
+	err = r.execute(ctx, s, executedMigrations(all, version), down)
+	if err != nil {
+		return err
+	}
+
+	return r.execute(ctx, s, r.pendingMigrations(all, version), up)
+}
+
+// checkVersion makes sure version belongs to a known migration, so a typo
+// doesn't roll back everything.
+func (r *Runner) checkVersion(ctx context.Context, s session, version int64) error {
+	migrations, err := r.loadMigrations(ctx, s.executor())
+	if err != nil {
+		return err
+	}
+
+	return hasVersion(migrations, version)
+}
+
+// hasVersion returns an error if no migration has version, version 0 is
+// the state before all migrations.
+func hasVersion(migrations []*migration, version int64) error {
+	if version == 0 {
+		return nil
+	}
+
+	for _, m := range migrations {
+		if m.CreatedAt.Unix() == version {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("there is no migration with version %d", version)
+}